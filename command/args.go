@@ -0,0 +1,506 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// Invocation is how a command was called: the name or alias used, the
+// subcommand it was routed to, if any, and the argument text after them,
+// before any splitting.
+type Invocation struct {
+	Name       string
+	Subcommand string
+	ArgText    string
+}
+
+type invocationKey struct{}
+
+func WithInvocation(ctx context.Context, inv Invocation) context.Context {
+	return context.WithValue(ctx, invocationKey{}, inv)
+}
+
+// InvocationFrom returns the invocation stored in ctx, if any.
+func InvocationFrom(ctx context.Context) (Invocation, bool) {
+	inv, ok := ctx.Value(invocationKey{}).(Invocation)
+	return inv, ok
+}
+
+// ArgText returns the raw argument text of the running command, falling back
+// to joining args when the command was not invoked from a message.
+func ArgText(ctx context.Context, args []string) string {
+	if inv, ok := InvocationFrom(ctx); ok {
+		return inv.ArgText
+	}
+	return strings.Join(args, " ")
+}
+
+// Tokenize splits s into words like a shell does: whitespace separates words,
+// single quotes keep everything literal and double quotes allow \" and \\
+// escapes. Outside quotes, a backslash escapes a following space, quote or
+// backslash. Any other backslash is literal, so paths like C:\tmp survive, as
+// is a quote in the middle of a word, such as the apostrophe in "don't".
+func Tokenize(s string) ([]string, error) {
+	var (
+		words   []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if !escapable(r, quote) {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case (r == '"' || r == '\'') && !inWord:
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		cur.WriteRune('\\')
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// escapable reports whether a backslash escapes r, inside the given quote or
+// outside quotes when quote is 0.
+func escapable(r, quote rune) bool {
+	switch r {
+	case '"', '\\':
+		return true
+	case '\'', ' ', '\t', '\n':
+		return quote == 0
+	}
+	return false
+}
+
+type ArgType int
+
+const (
+	TypeString ArgType = iota
+	TypeInt
+	TypeDuration
+	TypeUserID
+	TypeRoomAlias
+	// TypeBool is for flags that take no value.
+	TypeBool
+)
+
+func (t ArgType) placeholder() string {
+	switch t {
+	case TypeInt:
+		return "N"
+	case TypeDuration:
+		return "duration"
+	case TypeUserID:
+		return "@user:server"
+	case TypeRoomAlias:
+		return "#room:server"
+	}
+	return "value"
+}
+
+func (t ArgType) parse(s string) (any, error) {
+	switch t {
+	case TypeInt:
+		return ParseInt(s)
+	case TypeDuration:
+		return ParseDuration(s)
+	case TypeUserID:
+		return ParseUserID(s)
+	case TypeRoomAlias:
+		return ParseRoomAlias(s)
+	}
+	return s, nil
+}
+
+// ParseInt, ParseDuration, ParseUserID and ParseRoomAlias parse one word as
+// the typed arguments of a Spec do, with the same errors, for commands whose
+// grammar a Spec can't describe.
+func ParseInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+// ParseDuration accepts positive durations in time.ParseDuration's units
+// and whole days, as in "2d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	rest := s
+	if d, r, ok := strings.Cut(s, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a duration (e.g. 30m, 2h, 2d)", s)
+		}
+		days, rest = time.Duration(n)*24*time.Hour, r
+	}
+	d := time.Duration(0)
+	if rest != "" {
+		var err error
+		if d, err = time.ParseDuration(rest); err != nil {
+			return 0, fmt.Errorf("%q is not a duration (e.g. 30m, 2h, 2d)", s)
+		}
+	}
+	if days+d <= 0 {
+		return 0, fmt.Errorf("%q is not a duration (e.g. 30m, 2h, 2d)", s)
+	}
+	return days + d, nil
+}
+
+func ParseUserID(s string) (id.UserID, error) {
+	u := id.UserID(s)
+	if _, _, err := u.ParseAndValidateRelaxed(); err != nil {
+		return "", fmt.Errorf("%q is not a user ID (e.g. @alice:example.org)", s)
+	}
+	return u, nil
+}
+
+func ParseRoomAlias(s string) (id.RoomAlias, error) {
+	if !strings.HasPrefix(s, "#") || !strings.Contains(s, ":") {
+		return "", fmt.Errorf("%q is not a room alias (e.g. #room:example.org)", s)
+	}
+	return id.RoomAlias(s), nil
+}
+
+// Flag is a named option, given as --name or -short. Flags of TypeBool take
+// no value; others take the next word or --name=value. With OptionalValue the
+// next word is only consumed if it parses as the flag's type.
+type Flag struct {
+	Name          string
+	Short         string
+	Type          ArgType
+	OptionalValue bool
+	Placeholder   string
+}
+
+// Arg is a positional argument. Only the last one may be Variadic, in which
+// case it collects all remaining words.
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	Variadic bool
+}
+
+// Spec declares the arguments of a command, for parsing and for generating
+// its usage line.
+type Spec struct {
+	Command string
+	Flags   []Flag
+	Args    []Arg
+}
+
+// UsageError is a problem with the arguments given to a command. Its message
+// ends with the usage line generated from the spec.
+type UsageError struct {
+	Spec *Spec
+	Msg  string
+}
+
+func (e *UsageError) Error() string {
+	if e.Msg == "" {
+		return "Usage: " + e.Spec.Usage()
+	}
+	return e.Msg + "\nUsage: " + e.Spec.Usage()
+}
+
+// IsUsageError reports whether err came from parsing arguments.
+func IsUsageError(err error) bool {
+	var ue *UsageError
+	return errors.As(err, &ue)
+}
+
+// Usage renders the spec as a usage line, e.g.
+// "!poll [--multi [N]] [--closes duration] <question> [option...]".
+func (s *Spec) Usage() string {
+	parts := []string{"!" + s.Command}
+	for _, f := range s.Flags {
+		name := "--" + f.Name
+		if f.Short != "" {
+			name = "-" + f.Short + "|" + name
+		}
+		if f.Type != TypeBool {
+			ph := f.Placeholder
+			if ph == "" {
+				ph = f.Type.placeholder()
+			}
+			if f.OptionalValue {
+				ph = "[" + ph + "]"
+			}
+			name += " " + ph
+		}
+		parts = append(parts, "["+name+"]")
+	}
+	for _, a := range s.Args {
+		name := a.Name
+		if a.Variadic {
+			name += "..."
+		}
+		if a.Optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Args holds parsed flags and positional arguments by name.
+type Args struct {
+	values map[string]any
+	rest   map[string][]string
+}
+
+// Has reports whether a flag or positional argument was given.
+func (a *Args) Has(name string) bool {
+	_, ok := a.values[name]
+	if !ok {
+		_, ok = a.rest[name]
+	}
+	return ok
+}
+
+func (a *Args) Bool(name string) bool {
+	v, _ := a.values[name].(bool)
+	return v
+}
+
+func (a *Args) String(name string) string {
+	v, _ := a.values[name].(string)
+	return v
+}
+
+func (a *Args) Int(name string) int {
+	v, _ := a.values[name].(int)
+	return v
+}
+
+func (a *Args) Duration(name string) time.Duration {
+	v, _ := a.values[name].(time.Duration)
+	return v
+}
+
+func (a *Args) UserID(name string) id.UserID {
+	v, _ := a.values[name].(id.UserID)
+	return v
+}
+
+func (a *Args) RoomAlias(name string) id.RoomAlias {
+	v, _ := a.values[name].(id.RoomAlias)
+	return v
+}
+
+// Strings returns the words collected by a variadic argument.
+func (a *Args) Strings(name string) []string {
+	return a.rest[name]
+}
+
+// Parse tokenizes raw and matches the words against the spec. Flags come
+// first: the first positional word, or a "--" word, ends them, so later words
+// that look like flags, such as the "-u" in "vim -u NONE", are positional.
+// Errors are *UsageError.
+func (s *Spec) Parse(raw string) (*Args, error) {
+	words, err := Tokenize(raw)
+	if err != nil {
+		return nil, s.errorf("Invalid arguments: %v", err)
+	}
+	return s.ParseWords(words)
+}
+
+// ParseWords is Parse for input that is already split into words.
+func (s *Spec) ParseWords(words []string) (*Args, error) {
+	a := &Args{values: make(map[string]any), rest: make(map[string][]string)}
+	n, err := s.parseFlags(a, words)
+	if err != nil {
+		return nil, err
+	}
+	pos := words[n:]
+	if len(pos) > 0 && pos[0] == "--" {
+		pos = pos[1:]
+	}
+
+	for _, arg := range s.Args {
+		if arg.Variadic {
+			if len(pos) == 0 && !arg.Optional {
+				return nil, s.errorf("Missing %s", arg.Name)
+			}
+			for _, w := range pos {
+				if _, err := arg.Type.parse(w); err != nil {
+					return nil, s.errorf("Invalid %s: %v", arg.Name, err)
+				}
+			}
+			if len(pos) > 0 {
+				a.rest[arg.Name] = pos
+			}
+			pos = nil
+			break
+		}
+		if len(pos) == 0 {
+			if arg.Optional {
+				continue
+			}
+			return nil, s.errorf("Missing %s", arg.Name)
+		}
+		v, err := arg.Type.parse(pos[0])
+		if err != nil {
+			return nil, s.errorf("Invalid %s: %v", arg.Name, err)
+		}
+		a.values[arg.Name] = v
+		pos = pos[1:]
+	}
+	if len(pos) > 0 {
+		return nil, s.errorf("Unexpected argument %q", pos[0])
+	}
+	return a, nil
+}
+
+// ParsePrefix parses the flags at the start of raw and returns the rest of
+// raw untouched, for commands whose positional arguments have a syntax of
+// their own. The flags are split on whitespace only, without quoting, and the
+// spec's positional arguments are not checked.
+func (s *Spec) ParsePrefix(raw string) (*Args, string, error) {
+	var words []string
+	var starts []int
+	for i := 0; i < len(raw); {
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		start := i
+		for i < len(raw) && !isSpace(raw[i]) {
+			i++
+		}
+		if i > start {
+			words = append(words, raw[start:i])
+			starts = append(starts, start)
+		}
+	}
+	a := &Args{values: make(map[string]any), rest: make(map[string][]string)}
+	n, err := s.parseFlags(a, words)
+	if err != nil {
+		return nil, "", err
+	}
+	if n < len(words) && words[n] == "--" {
+		n++
+	}
+	if n == len(words) {
+		return a, "", nil
+	}
+	return a, strings.TrimSpace(raw[starts[n]:]), nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// parseFlags parses the flags at the start of words into a and returns the
+// index of the first word that is not one: the first positional word or "--".
+func (s *Spec) parseFlags(a *Args, words []string) (int, error) {
+	i := 0
+	for ; i < len(words); i++ {
+		w := words[i]
+		if w == "--" || !isFlag(w) {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		f := s.flag(name, !strings.HasPrefix(w, "--"))
+		if f == nil {
+			return 0, s.errorf("Unknown option %s", w)
+		}
+		if f.Type == TypeBool {
+			if hasValue {
+				return 0, s.errorf("Option --%s takes no value", f.Name)
+			}
+			a.values[f.Name] = true
+			continue
+		}
+		if !hasValue {
+			if i+1 < len(words) {
+				next := words[i+1]
+				if _, err := f.Type.parse(next); err == nil || !f.OptionalValue {
+					value, hasValue = next, true
+					i++
+				}
+			}
+		}
+		if !hasValue {
+			if f.OptionalValue {
+				a.values[f.Name] = true
+				continue
+			}
+			return 0, s.errorf("Option --%s needs a value", f.Name)
+		}
+		v, err := f.Type.parse(value)
+		if err != nil {
+			return 0, s.errorf("Option --%s: %v", f.Name, err)
+		}
+		a.values[f.Name] = v
+	}
+	return i, nil
+}
+
+func (s *Spec) errorf(format string, args ...any) error {
+	return &UsageError{Spec: s, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (s *Spec) flag(name string, short bool) *Flag {
+	for i := range s.Flags {
+		f := &s.Flags[i]
+		if (short && f.Short == name) || (!short && f.Name == name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// isFlag tells flags from other words that start with a dash, such as
+// negative numbers or a lone "-".
+func isFlag(w string) bool {
+	name := strings.TrimLeft(w, "-")
+	return strings.HasPrefix(w, "-") && name != "" && (name[0] < '0' || name[0] > '9')
+}
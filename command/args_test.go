@@ -0,0 +1,208 @@
+package command
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "   ", want: nil},
+		{in: "a b  c", want: []string{"a", "b", "c"}},
+		{in: "a\tb\nc", want: []string{"a", "b", "c"}},
+		{in: `"Lunch?" "Pizza place" Sushi`, want: []string{"Lunch?", "Pizza place", "Sushi"}},
+		{in: `'single "quoted"' x`, want: []string{`single "quoted"`, "x"}},
+		{in: `"say \"hi\""`, want: []string{`say "hi"`}},
+		{in: `"a\\b"`, want: []string{`a\b`}},
+		{in: `""`, want: []string{""}},
+		{in: `a\ b`, want: []string{"a b"}},
+		{in: `\"x`, want: []string{`"x`}},
+		{in: `don't stop`, want: []string{"don't", "stop"}},
+		{in: `C:\tmp`, want: []string{`C:\tmp`}},
+		{in: `"C:\tmp"`, want: []string{`C:\tmp`}},
+		{in: `'C:\tmp'`, want: []string{`C:\tmp`}},
+		{in: `a\\b`, want: []string{`a\b`}},
+		{in: `trailing\`, want: []string{`trailing\`}},
+		{in: `Best editor? | vim -u NONE | emacs -nw`, want: []string{"Best", "editor?", "|", "vim", "-u", "NONE", "|", "emacs", "-nw"}},
+		{in: `Is it "good? | yes | no`, wantErr: true},
+		{in: `'open`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Tokenize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+var testSpec = &Spec{
+	Command: "test",
+	Flags: []Flag{
+		{Name: "multi", Short: "m", Type: TypeInt, OptionalValue: true},
+		{Name: "secret", Short: "s", Type: TypeBool},
+		{Name: "closes", Type: TypeDuration},
+		{Name: "to", Type: TypeUserID},
+	},
+	Args: []Arg{
+		{Name: "count", Type: TypeInt},
+		{Name: "text", Variadic: true, Optional: true},
+	},
+}
+
+func TestParseWords(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		check   func(*Args) bool
+		wantErr bool
+	}{
+		{
+			name:  "positional only",
+			words: []string{"3", "hello", "world"},
+			check: func(a *Args) bool {
+				return a.Int("count") == 3 && slices.Equal(a.Strings("text"), []string{"hello", "world"})
+			},
+		},
+		{
+			name:  "flags first",
+			words: []string{"--secret", "--closes", "2h", "-m", "2", "3"},
+			check: func(a *Args) bool {
+				return a.Bool("secret") && a.Duration("closes") == 2*time.Hour && a.Int("multi") == 2 && a.Int("count") == 3
+			},
+		},
+		{
+			name:  "flag with =",
+			words: []string{"--closes=1d12h", "1"},
+			check: func(a *Args) bool { return a.Duration("closes") == 36*time.Hour },
+		},
+		{
+			name:  "optional value taken when it parses",
+			words: []string{"--multi", "3", "1"},
+			check: func(a *Args) bool { return a.Int("multi") == 3 && a.Int("count") == 1 },
+		},
+		{
+			name:  "optional value not a number",
+			words: []string{"--multi", "--secret", "3"},
+			check: func(a *Args) bool { return a.Bool("multi") && a.Bool("secret") && a.Int("count") == 3 },
+		},
+		{
+			name:  "flags end at the first positional word",
+			words: []string{"1", "vim", "-u", "NONE", "--secret"},
+			check: func(a *Args) bool {
+				return !a.Bool("secret") && slices.Equal(a.Strings("text"), []string{"vim", "-u", "NONE", "--secret"})
+			},
+		},
+		{
+			name:  "poll text with dashes",
+			words: []string{"1", "Best", "editor?", "|", "vim", "-u", "NONE", "|", "emacs", "-nw"},
+			check: func(a *Args) bool { return len(a.Strings("text")) == 9 },
+		},
+		{
+			name:  "double dash",
+			words: []string{"--secret", "--", "-5", "--closes"},
+			check: func(a *Args) bool {
+				return a.Bool("secret") && a.Int("count") == -5 && slices.Equal(a.Strings("text"), []string{"--closes"})
+			},
+		},
+		{
+			name:  "negative number is positional",
+			words: []string{"-3"},
+			check: func(a *Args) bool { return a.Int("count") == -3 },
+		},
+		{
+			name:  "user ID",
+			words: []string{"--to", "@alice:example.org", "1"},
+			check: func(a *Args) bool { return a.UserID("to") == id.UserID("@alice:example.org") },
+		},
+		{name: "unknown option", words: []string{"--nope", "1"}, wantErr: true},
+		{name: "unknown short option", words: []string{"-x", "1"}, wantErr: true},
+		{name: "bool with value", words: []string{"--secret=yes", "1"}, wantErr: true},
+		{name: "missing value", words: []string{"--closes"}, wantErr: true},
+		{name: "bad duration", words: []string{"--closes", "soon", "1"}, wantErr: true},
+		{name: "bad user ID", words: []string{"--to", "alice", "1"}, wantErr: true},
+		{name: "missing positional", words: []string{"--secret"}, wantErr: true},
+		{name: "bad int", words: []string{"three"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := testSpec.ParseWords(tt.words)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWords(%q) error = %v, want error %v", tt.words, err, tt.wantErr)
+			}
+			if err != nil {
+				if !IsUsageError(err) {
+					t.Errorf("ParseWords(%q) error %v is not a usage error", tt.words, err)
+				}
+				return
+			}
+			if !tt.check(a) {
+				t.Errorf("ParseWords(%q) = %+v", tt.words, a)
+			}
+		})
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		raw     string
+		secret  bool
+		rest    string
+		wantErr bool
+	}{
+		{raw: "Best editor? | vim -u NONE | emacs -nw", rest: "Best editor? | vim -u NONE | emacs -nw"},
+		{raw: `--secret  Is it "good? | yes | no`, secret: true, rest: `Is it "good? | yes | no`},
+		{raw: `--closes 1h -s C:\tmp | a | b`, secret: true, rest: `C:\tmp | a | b`},
+		{raw: "--secret -- --not-a-flag | a", secret: true, rest: "--not-a-flag | a"},
+		{raw: "--secret", secret: true, rest: ""},
+		{raw: "--nope | a | b", wantErr: true},
+	}
+	for _, tt := range tests {
+		a, rest, err := testSpec.ParsePrefix(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePrefix(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if a.Bool("secret") != tt.secret || rest != tt.rest {
+			t.Errorf("ParsePrefix(%q) = secret %v, rest %q; want %v, %q", tt.raw, a.Bool("secret"), rest, tt.secret, tt.rest)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30m", want: 30 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "2d", want: 48 * time.Hour},
+		{in: "1d12h", want: 36 * time.Hour},
+		{in: "0s", wantErr: true},
+		{in: "-5m", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "xd", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
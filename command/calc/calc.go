@@ -8,6 +8,8 @@ import (
 	"github.com/Knetic/govaluate"
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type CalcCmd struct{}
@@ -16,21 +18,25 @@ func (*CalcCmd) Name() string      { return "calc" }
 func (*CalcCmd) Aliases() []string { return []string{} }
 func (*CalcCmd) Usage() string     { return "!calc <expr> - Evaluate a math expression" }
 
+func (*CalcCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Evaluate a math expression", Examples: []string{"!calc (3 + 4) * 2", "!calc 2 ** 10"}}
+}
+
 func (c *CalcCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
 	if len(args) < 1 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+c.Usage())
+		command.ReplyUsage(ctx, cli, evt, c.Usage())
 		return
 	}
 	expr := strings.Join(args, " ")
 	e, err := govaluate.NewEvaluableExpression(expr)
 	if err != nil {
-		cli.SendText(ctx, evt.RoomID, "Invalid expression")
+		command.Reply(ctx, cli, evt, "Invalid expression")
 		return
 	}
 	res, err := e.Evaluate(nil)
 	if err != nil {
-		cli.SendText(ctx, evt.RoomID, fmt.Sprintf("Error: %v", err))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Error: %v", err))
 		return
 	}
-	cli.SendText(ctx, evt.RoomID, fmt.Sprintf("%v", res))
+	command.Reply(ctx, cli, evt, fmt.Sprintf("%v", res))
 }
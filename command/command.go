@@ -2,10 +2,11 @@ package command
 
 import (
 	"context"
-	"strings"
+	"slices"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 )
 
 type Command interface {
@@ -32,6 +33,65 @@ func MessageHandlers() []MessageHandler {
 	return messageHandlers
 }
 
+type ReactionHandler interface {
+	HandleReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event)
+}
+
+var reactionHandlers []ReactionHandler
+
+func RegisterReactionHandler(h ...ReactionHandler) {
+	if len(h) == 0 {
+		return
+	}
+	reactionHandlers = append(reactionHandlers, h...)
+}
+
+func ReactionHandlers() []ReactionHandler {
+	return reactionHandlers
+}
+
+// BacklogReactionHandler is a ReactionHandler that also takes reactions sent
+// before the bot started, which the others never see. Handling one twice must
+// be harmless.
+type BacklogReactionHandler interface {
+	ReactionHandler
+	HandleBacklogReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event)
+}
+
+type PollResponseHandler interface {
+	HandlePollResponse(ctx context.Context, cli *mautrix.Client, evt *event.Event)
+}
+
+var pollResponseHandlers []PollResponseHandler
+
+func RegisterPollResponseHandler(h ...PollResponseHandler) {
+	if len(h) == 0 {
+		return
+	}
+	pollResponseHandlers = append(pollResponseHandlers, h...)
+}
+
+func PollResponseHandlers() []PollResponseHandler {
+	return pollResponseHandlers
+}
+
+type RedactionHandler interface {
+	HandleRedaction(ctx context.Context, cli *mautrix.Client, evt *event.Event)
+}
+
+var redactionHandlers []RedactionHandler
+
+func RegisterRedactionHandler(h ...RedactionHandler) {
+	if len(h) == 0 {
+		return
+	}
+	redactionHandlers = append(redactionHandlers, h...)
+}
+
+func RedactionHandlers() []RedactionHandler {
+	return redactionHandlers
+}
+
 var Registry []Command
 
 func Register(cmd ...Command) {
@@ -41,23 +101,43 @@ func Register(cmd ...Command) {
 	Registry = append(Registry, cmd...)
 }
 
-type HelpCmd struct{}
+// Lookup finds a registered command by name or alias.
+func Lookup(name string) Command {
+	for _, cmd := range Registry {
+		if name == cmd.Name() || slices.Contains(cmd.Aliases(), name) {
+			return cmd
+		}
+	}
+	return nil
+}
 
-func (h *HelpCmd) Name() string      { return "help" }
-func (h *HelpCmd) Aliases() []string { return []string{} }
-func (h *HelpCmd) Usage() string     { return "!help - Show this help message" }
+// Resolver provides commands that exist only in some rooms, such as ones
+// defined by users.
+type Resolver interface {
+	Resolve(roomID id.RoomID, name string) Command
+	// Names lists the commands the resolver has for the room.
+	Names(roomID id.RoomID) []string
+}
+
+var resolvers []Resolver
 
-func (h *HelpCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	if len(args) > 0 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+h.Usage())
+func RegisterResolver(r ...Resolver) {
+	if len(r) == 0 {
 		return
 	}
+	resolvers = append(resolvers, r...)
+}
 
-	var helpMsg strings.Builder
-	for _, cmd := range Registry {
-		helpMsg.WriteString(cmd.Usage() + "\n")
+// LookupIn finds a command as it is called in a room: registered commands
+// come first, then those of the resolvers.
+func LookupIn(roomID id.RoomID, name string) Command {
+	if cmd := Lookup(name); cmd != nil {
+		return cmd
 	}
-	if _, err := cli.SendText(ctx, evt.RoomID, helpMsg.String()); err != nil {
-		cli.SendText(ctx, evt.RoomID, "Error sending help message")
+	for _, r := range resolvers {
+		if cmd := r.Resolve(roomID, name); cmd != nil {
+			return cmd
+		}
 	}
+	return nil
 }
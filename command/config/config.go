@@ -0,0 +1,247 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/state"
+)
+
+// maxPrefixLen keeps prefixes short enough to type; anything longer is more
+// likely a mistake than a preference.
+const maxPrefixLen = 3
+
+var languageRe = regexp.MustCompile(`^[a-z]{2}$`)
+
+// ConfigCmd manages per-room settings. They are cached in memory, since every
+// message consults them.
+type ConfigCmd struct {
+	store *state.Namespace
+
+	mu    sync.Mutex
+	cache map[id.RoomID]command.RoomSettings
+}
+
+func NewConfigCmd(store *state.Namespace) *ConfigCmd {
+	return &ConfigCmd{store: store, cache: make(map[id.RoomID]command.RoomSettings)}
+}
+
+func (*ConfigCmd) Name() string      { return "config" }
+func (*ConfigCmd) Aliases() []string { return []string{} }
+func (c *ConfigCmd) Usage() string   { return c.Router().Usage() }
+
+func (*ConfigCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryRoom, Summary: "Change this room's settings", Examples: []string{"!config", "!config prefix ?", "!config disable roulette", "!config language de", "!config output file 20"}}
+}
+
+func (*ConfigCmd) Permission() command.Permission {
+	return command.Permission{Role: command.RoleModerator}
+}
+
+func (c *ConfigCmd) Router() *command.Router {
+	return &command.Router{
+		Command:      "config",
+		Default:      c.show,
+		DefaultUsage: "!config - Show this room's settings",
+		Subcommands: []command.Subcommand{
+			{Name: "prefix", Usage: "!config prefix <prefix> - Set the command prefix", Handler: c.prefix, MaxArgs: 1},
+			{Name: "enable", Usage: "!config enable <command> - Allow a command in this room", Handler: c.toggle(true), MaxArgs: 1},
+			{Name: "disable", Usage: "!config disable <command> - Turn a command off in this room", Handler: c.toggle(false), MaxArgs: 1},
+			{Name: "language", Aliases: []string{"lang"}, Usage: "!config language <code> - Set the output language (ISO 639-1, e.g. en, de)", Handler: c.language, MaxArgs: 1},
+			{Name: "output", Usage: "!config output <split|file> [lines] - Split long replies into several messages or upload them as a file, past a number of lines", Handler: c.output, MaxArgs: 2},
+			{Name: "reset", Usage: "!config reset - Restore the defaults", Handler: c.reset, MaxArgs: command.NoArgs},
+		},
+	}
+}
+
+func (c *ConfigCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	c.Router().Route(ctx, cli, evt, args)
+}
+
+// Settings returns the room's settings. Load errors are logged and give the
+// defaults, so a broken store never silences the bot.
+func (c *ConfigCmd) Settings(roomID id.RoomID) command.RoomSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.cache[roomID]; ok {
+		return s
+	}
+	var s command.RoomSettings
+	if err := c.store.GetJSON(roomID.String(), &s); err != nil {
+		log.Printf("config: error loading settings of %s: %v", roomID, err)
+		return s
+	}
+	c.cache[roomID] = s
+	return s
+}
+
+// update applies fn to the room's settings and saves them.
+func (c *ConfigCmd) update(roomID id.RoomID, fn func(*command.RoomSettings)) error {
+	s := c.Settings(roomID)
+	s.Disabled = slices.Clone(s.Disabled)
+	fn(&s)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.store.PutJSON(roomID.String(), s); err != nil {
+		return err
+	}
+	c.cache[roomID] = s
+	return nil
+}
+
+func (c *ConfigCmd) show(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+	s := c.Settings(evt.RoomID)
+	disabled := "none"
+	if len(s.Disabled) > 0 {
+		disabled = strings.Join(s.Disabled, ", ")
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Prefix: %s\nLanguage: %s\nDisabled commands: %s\nLong replies: %s past %d lines",
+		s.CommandPrefix(), s.Lang(), disabled, describeOutput(s.OutputMode()), s.LineLimit()))
+}
+
+func (c *ConfigCmd) prefix(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) != 1 || len([]rune(args[0])) > maxPrefixLen {
+		command.ReplyUsage(ctx, cli, evt, fmt.Sprintf("!config prefix <prefix> (up to %d characters)", maxPrefixLen))
+		return
+	}
+	p := args[0]
+	err := c.update(evt.RoomID, func(s *command.RoomSettings) {
+		s.Prefix = p
+		if p == command.DefaultPrefix {
+			s.Prefix = ""
+		}
+	})
+	if err != nil {
+		log.Printf("config: error saving prefix: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Commands in this room now start with %s, e.g. %shelp", p, p))
+}
+
+func (c *ConfigCmd) toggle(enable bool) command.Handler {
+	return func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+		if len(args) != 1 {
+			command.ReplyUsage(ctx, cli, evt, "!config enable|disable <command>")
+			return
+		}
+		prefix := command.RoomSettingsFrom(ctx).CommandPrefix()
+		cmd := command.Lookup(strings.TrimPrefix(args[0], prefix))
+		if cmd == nil {
+			command.Reply(ctx, cli, evt, fmt.Sprintf("Unknown command %q", args[0]))
+			return
+		}
+		name := cmd.Name()
+		if !enable && (name == c.Name() || name == "help") {
+			command.Reply(ctx, cli, evt, fmt.Sprintf("%s%s can't be disabled.", prefix, name))
+			return
+		}
+		err := c.update(evt.RoomID, func(s *command.RoomSettings) {
+			s.Disabled = slices.DeleteFunc(s.Disabled, func(d string) bool { return d == name })
+			if !enable {
+				s.Disabled = append(s.Disabled, name)
+				slices.Sort(s.Disabled)
+			}
+		})
+		if err != nil {
+			log.Printf("config: error saving disabled commands: %v", err)
+			command.Reply(ctx, cli, evt, "Internal error")
+			return
+		}
+		status := "disabled"
+		if enable {
+			status = "enabled"
+		}
+		command.Reply(ctx, cli, evt, fmt.Sprintf("%s%s is now %s in this room.", prefix, name, status))
+	}
+}
+
+func (c *ConfigCmd) language(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) != 1 || !languageRe.MatchString(strings.ToLower(args[0])) {
+		command.ReplyUsage(ctx, cli, evt, "!config language <code>, a two-letter ISO 639-1 code such as en or de")
+		return
+	}
+	lang := strings.ToLower(args[0])
+	err := c.update(evt.RoomID, func(s *command.RoomSettings) {
+		s.Language = lang
+		if lang == command.DefaultLanguage {
+			s.Language = ""
+		}
+	})
+	if err != nil {
+		log.Printf("config: error saving language: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Output language for this room is now %s. Commands that can't use it fall back to English.", lang))
+}
+
+func (c *ConfigCmd) output(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	usage := command.Prefixed(ctx, fmt.Sprintf("Usage: !config output <split|file> [lines], with lines from %d to %d", command.MinMaxLines, command.MaxMaxLines))
+	if len(args) == 0 {
+		command.Reply(ctx, cli, evt, usage)
+		return
+	}
+	mode := strings.ToLower(args[0])
+	if mode != command.OutputSplit && mode != command.OutputFile {
+		command.Reply(ctx, cli, evt, usage)
+		return
+	}
+	lines := c.Settings(evt.RoomID).LineLimit()
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < command.MinMaxLines || n > command.MaxMaxLines {
+			command.Reply(ctx, cli, evt, usage)
+			return
+		}
+		lines = n
+	}
+	err := c.update(evt.RoomID, func(s *command.RoomSettings) {
+		s.Output, s.MaxLines = mode, lines
+		if mode == command.OutputSplit {
+			s.Output = ""
+		}
+		if lines == command.DefaultMaxLines {
+			s.MaxLines = 0
+		}
+	})
+	if err != nil {
+		log.Printf("config: error saving output mode: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Replies longer than %d lines are now %s.", lines, describeOutput(mode)))
+}
+
+func describeOutput(mode string) string {
+	if mode == command.OutputFile {
+		return "uploaded as a file"
+	}
+	return "split into several messages"
+}
+
+func (c *ConfigCmd) reset(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+	c.mu.Lock()
+	err := c.store.Delete(evt.RoomID.String())
+	if err == nil {
+		delete(c.cache, evt.RoomID)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		log.Printf("config: error resetting settings: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, "Settings reset. Commands start with "+command.DefaultPrefix+" again.")
+}
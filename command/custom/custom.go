@@ -0,0 +1,267 @@
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/internal/matrixutil"
+	"github.com/hionay/rubyChan/state"
+)
+
+// maxPerRoom bounds how many custom commands a room can define.
+const maxPerRoom = 100
+
+var nameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// definition is a custom command: a text template, or, when Target is set,
+// an alias running Target with Args in front of the caller's arguments.
+type definition struct {
+	Name      string    `json:"name"`
+	Template  string    `json:"template,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Args      string    `json:"args,omitempty"`
+	Creator   id.UserID `json:"creator"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func defKey(roomID id.RoomID, name string) string { return roomID.String() + "|" + name }
+
+// CustomCmd manages the per-room commands and resolves them for dispatch.
+type CustomCmd struct {
+	store *state.Namespace
+	mu    sync.Mutex
+}
+
+func NewCustomCmd(store *state.Namespace) *CustomCmd {
+	return &CustomCmd{store: store}
+}
+
+func (*CustomCmd) Name() string      { return "cmd" }
+func (*CustomCmd) Aliases() []string { return []string{} }
+func (c *CustomCmd) Usage() string   { return c.Router().Usage() }
+
+func (*CustomCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryRoom, Summary: "Define this room's own commands", Examples: []string{"!cmd add rules Please read the pinned message, {sender}", "!cmd alias home weather Kadıköy", "!cmd list"}}
+}
+
+// Stateful keeps edits from running the command again. Every run changes the room's commands.
+func (*CustomCmd) Stateful() bool { return true }
+
+func (c *CustomCmd) Router() *command.Router {
+	return &command.Router{
+		Command: "cmd",
+		Default: c.list,
+		Subcommands: []command.Subcommand{
+			{Name: "add", Usage: "!cmd add <name> <template> - Define a command that replies with the template; {sender}, {room}, {args} and {arg1}, {arg2}… are filled in", Handler: c.add},
+			{Name: "alias", Usage: "!cmd alias <name> <command> [args...] - Define a shortcut for a command with preset arguments, e.g. !cmd alias home weather Kadıköy", Handler: c.alias},
+			{Name: "del", Aliases: []string{"rm"}, Usage: "!cmd del <name> - Remove a custom command (its creator or a moderator)", Handler: c.del, MaxArgs: 1},
+			{Name: "list", Usage: "!cmd list - List this room's custom commands", Handler: c.list, MaxArgs: command.NoArgs},
+		},
+	}
+}
+
+func (c *CustomCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	c.Router().Route(ctx, cli, evt, args)
+}
+
+// Resolve implements command.Resolver.
+func (c *CustomCmd) Resolve(roomID id.RoomID, name string) command.Command {
+	d, err := c.load(roomID, strings.ToLower(name))
+	if err != nil {
+		log.Printf("custom: error loading %s in %s: %v", name, roomID, err)
+		return nil
+	}
+	if d == nil {
+		return nil
+	}
+	if d.Target != "" {
+		return &alias{def: *d}
+	}
+	return &macro{def: *d}
+}
+
+// Names implements command.Resolver.
+func (c *CustomCmd) Names(roomID id.RoomID) []string {
+	defs, err := c.roomDefs(roomID)
+	if err != nil {
+		log.Printf("custom: error listing commands in %s: %v", roomID, err)
+	}
+	names := make([]string, len(defs))
+	for i, d := range defs {
+		names[i] = d.Name
+	}
+	return names
+}
+
+func (c *CustomCmd) load(roomID id.RoomID, name string) (*definition, error) {
+	var d definition
+	if err := c.store.GetJSON(defKey(roomID, name), &d); err != nil {
+		return nil, err
+	}
+	if d.Name == "" {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+func (c *CustomCmd) roomDefs(roomID id.RoomID) ([]definition, error) {
+	var defs []definition
+	err := c.store.ForEach(roomID.String()+"|", func(_ string, value []byte) error {
+		var d definition
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
+		defs = append(defs, d)
+		return nil
+	})
+	return defs, err
+}
+
+// validName checks a new command's name, returning a reason it can't be used.
+func validName(name string) string {
+	if !nameRe.MatchString(name) {
+		return "Command names are up to 32 lowercase letters, digits, - or _."
+	}
+	if command.Lookup(name) != nil {
+		return fmt.Sprintf("%q is a built-in command.", name)
+	}
+	return ""
+}
+
+func (c *CustomCmd) save(ctx context.Context, cli *mautrix.Client, evt *event.Event, d definition) {
+	if reason := validName(d.Name); reason != "" {
+		command.Reply(ctx, cli, evt, reason)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	existing, err := c.load(evt.RoomID, d.Name)
+	if err != nil {
+		log.Printf("custom: error loading %s: %v", d.Name, err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	if existing != nil {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("%s%s already exists; delete it first with %scmd del %s.", prefix(ctx), d.Name, prefix(ctx), d.Name))
+		return
+	}
+	defs, err := c.roomDefs(evt.RoomID)
+	if err != nil {
+		log.Printf("custom: error listing commands: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	if len(defs) >= maxPerRoom {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("This room already has %d custom commands.", maxPerRoom))
+		return
+	}
+
+	d.Creator = evt.Sender
+	d.CreatedAt = time.Now()
+	if err := c.store.PutJSON(defKey(evt.RoomID, d.Name), d); err != nil {
+		log.Printf("custom: error saving %s: %v", d.Name, err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Added %s%s", prefix(ctx), d.Name))
+}
+
+func (c *CustomCmd) add(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	name, template, _ := strings.Cut(command.ArgText(ctx, args), " ")
+	template = strings.TrimSpace(template)
+	if name == "" || template == "" {
+		command.ReplyUsage(ctx, cli, evt, "!cmd add <name> <template>")
+		return
+	}
+	c.save(ctx, cli, evt, definition{Name: strings.ToLower(name), Template: template})
+}
+
+func (c *CustomCmd) alias(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) < 2 {
+		command.ReplyUsage(ctx, cli, evt, "!cmd alias <name> <command> [args...]")
+		return
+	}
+	// Keep the target as typed, since some commands act on the alias they
+	// were called by, like !wf for the forecast.
+	target := strings.TrimPrefix(args[1], prefix(ctx))
+	if command.Lookup(target) == nil {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Unknown command %q; aliases can only point to built-in commands.", args[1]))
+		return
+	}
+	_, rest, _ := strings.Cut(command.ArgText(ctx, args), " ")
+	_, preset, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	c.save(ctx, cli, evt, definition{Name: strings.ToLower(args[0]), Target: target, Args: strings.TrimSpace(preset)})
+}
+
+func (c *CustomCmd) del(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) != 1 {
+		command.ReplyUsage(ctx, cli, evt, "!cmd del <name>")
+		return
+	}
+	name := strings.ToLower(strings.TrimPrefix(args[0], prefix(ctx)))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, err := c.load(evt.RoomID, name)
+	if err != nil {
+		log.Printf("custom: error loading %s: %v", name, err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	if d == nil {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("No custom command %s%s in this room.", prefix(ctx), name))
+		return
+	}
+	if d.Creator != evt.Sender && !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, "Only its creator or a room moderator can delete "+prefix(ctx)+name)
+		return
+	}
+	if err := c.store.Delete(defKey(evt.RoomID, name)); err != nil {
+		log.Printf("custom: error deleting %s: %v", name, err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Deleted %s%s", prefix(ctx), name))
+}
+
+func (c *CustomCmd) list(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+	defs, err := c.roomDefs(evt.RoomID)
+	if err != nil {
+		log.Printf("custom: error listing commands: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	if len(defs) == 0 {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("No custom commands in this room. Add one with %scmd add <name> <template>.", prefix(ctx)))
+		return
+	}
+	var b strings.Builder
+	b.WriteString("Custom commands:")
+	for _, d := range defs {
+		fmt.Fprintf(&b, "\n%s%s → %s", prefix(ctx), d.Name, d.describe(prefix(ctx)))
+	}
+	command.Reply(ctx, cli, evt, b.String())
+}
+
+func (d definition) describe(prefix string) string {
+	if d.Target == "" {
+		return d.Template
+	}
+	return strings.TrimSpace(prefix + d.Target + " " + d.Args)
+}
+
+func prefix(ctx context.Context) string {
+	return command.RoomSettingsFrom(ctx).CommandPrefix()
+}
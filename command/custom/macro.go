@@ -0,0 +1,118 @@
+package custom
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
+)
+
+var placeholderRe = regexp.MustCompile(`\{(sender|room|args|arg[1-9][0-9]*)\}`)
+
+// macro replies with its template, placeholders filled in.
+type macro struct {
+	def definition
+}
+
+func (m *macro) Name() string      { return m.def.Name }
+func (m *macro) Aliases() []string { return []string{} }
+func (m *macro) Usage() string     { return fmt.Sprintf("!%s - %s", m.def.Name, m.def.Template) }
+
+func (m *macro) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	text := placeholderRe.ReplaceAllStringFunc(m.def.Template, func(ph string) string {
+		switch name := strings.Trim(ph, "{}"); name {
+		case "sender":
+			return evt.Sender.String()
+		case "room":
+			return roomName(ctx, cli, evt)
+		case "args":
+			return command.ArgText(ctx, args)
+		default:
+			n, _ := strconv.Atoi(strings.TrimPrefix(name, "arg"))
+			if n > len(args) {
+				return ""
+			}
+			return args[n-1]
+		}
+	})
+	if _, err := command.Reply(ctx, cli, evt, text); err != nil {
+		log.Printf("custom: error sending %s: %v", m.def.Name, err)
+	}
+}
+
+// roomName is the room's name, or its ID when it has none.
+func roomName(ctx context.Context, cli *mautrix.Client, evt *event.Event) string {
+	var content event.RoomNameEventContent
+	if err := cli.StateEvent(ctx, evt.RoomID, event.StateRoomName, "", &content); err != nil || content.Name == "" {
+		return evt.RoomID.String()
+	}
+	return content.Name
+}
+
+// alias runs a built-in command with preset arguments in front of the
+// caller's own. Permissions, limits and deadlines are those of the target.
+type alias struct {
+	def definition
+}
+
+func (a *alias) Name() string      { return a.def.Name }
+func (a *alias) Aliases() []string { return []string{} }
+func (a *alias) Usage() string {
+	return fmt.Sprintf("!%s - Runs %s", a.def.Name, a.def.describe(command.DefaultPrefix))
+}
+
+func (a *alias) target() command.Command {
+	return command.Lookup(a.def.Target)
+}
+
+// Limits are the target's, cooldown included, so an alias is no way around
+// them.
+func (a *alias) Limits() command.Limits {
+	target := a.target()
+	if target == nil {
+		return command.Limits{}
+	}
+	var lim command.Limits
+	if l, ok := target.(command.Limited); ok {
+		lim = l.Limits()
+	}
+	lim.CooldownKey = cmp.Or(lim.CooldownKey, target.Name())
+	return lim
+}
+
+func (a *alias) Timeout() time.Duration {
+	if t, ok := a.target().(command.Timed); ok {
+		return t.Timeout()
+	}
+	return 0
+}
+
+func (a *alias) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	prefix := command.RoomSettingsFrom(ctx).CommandPrefix()
+	target := a.target()
+	if target == nil {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("%s%s points to %s%s, which no longer exists.", prefix, a.def.Name, prefix, a.def.Target))
+		return
+	}
+	if !command.RoomSettingsFrom(ctx).Enabled(target) {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("%s%s is disabled in this room.", prefix, target.Name()))
+		return
+	}
+	full := append(strings.Fields(a.def.Args), args...)
+	if err := command.Check(ctx, cli, evt, target, full); err != nil {
+		command.Reply(ctx, cli, evt, err.Error())
+		return
+	}
+	argText := strings.TrimSpace(a.def.Args + " " + command.ArgText(ctx, args))
+	ctx = command.WithInvocation(ctx, command.Invocation{Name: a.def.Target, ArgText: argText})
+	target.Execute(ctx, cli, evt, full)
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type FactCmd struct{}
@@ -16,18 +19,31 @@ func (*FactCmd) Name() string      { return "fact" }
 func (*FactCmd) Aliases() []string { return []string{} }
 func (*FactCmd) Usage() string     { return "!fact - Get today's useless fact" }
 
+func (*FactCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryFun, Summary: "Get today's useless fact"}
+}
+
 func (*FactCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
-	fact, err := fetchFact()
+	fact, err := fetchFact(ctx, command.Language(ctx))
 	if err != nil {
-		cli.SendText(ctx, evt.RoomID, "Error fetching fact: "+err.Error())
+		command.Reply(ctx, cli, evt, "Error fetching fact: "+err.Error())
 		return
 	}
-	cli.SendText(ctx, evt.RoomID, fact)
+	command.Reply(ctx, cli, evt, fact)
 }
 
-func fetchFact() (string, error) {
-	const url = "https://uselessfacts.jsph.pl/api/v2/facts/today?language=en"
-	resp, err := http.Get(url)
+// factLanguages are the languages the facts API has.
+var factLanguages = []string{"en", "de"}
+
+func fetchFact(ctx context.Context, lang string) (string, error) {
+	if !slices.Contains(factLanguages, lang) {
+		lang = command.DefaultLanguage
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://uselessfacts.jsph.pl/api/v2/facts/today?language="+lang, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
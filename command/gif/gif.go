@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/internal/matrixutil"
 )
 
 type GifCmd struct {
@@ -20,44 +25,56 @@ func (*GifCmd) Name() string      { return "gif" }
 func (*GifCmd) Aliases() []string { return nil }
 func (*GifCmd) Usage() string     { return "!gif <search terms> — Fetch a GIF from Tenor" }
 
+func (*GifCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryFun, Summary: "Fetch a GIF from Tenor", Examples: []string{"!gif happy dance"}}
+}
+
+func (*GifCmd) Limits() command.Limits {
+	return command.Limits{Cooldown: 5 * time.Second, APICost: 1}
+}
+
 func (c *GifCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
 	if len(args) < 1 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+c.Usage())
+		command.ReplyUsage(ctx, cli, evt, c.Usage())
 		return
 	}
 	if c.APIKey == "" {
-		cli.SendText(ctx, evt.RoomID, "TENOR_API_KEY not configured")
+		command.Reply(ctx, cli, evt, "TENOR_API_KEY not configured")
 		return
 	}
 
 	query := strings.Join(args, " ")
-	gifURL, err := fetchGif(c.APIKey, query)
+	gifURL, err := fetchGif(ctx, c.APIKey, query, command.Language(ctx))
 	if err != nil {
-		cli.SendText(ctx, evt.RoomID, fmt.Sprintf("Error fetching GIF: %v", err))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Error fetching GIF: %v", err))
 		return
 	}
 	if gifURL == "" {
-		cli.SendText(ctx, evt.RoomID, "No GIFs found.")
+		command.Reply(ctx, cli, evt, "No GIFs found.")
 		return
 	}
 
-	mention := fmt.Sprintf(`<a href="https://matrix.to/#/%s">%s</a>`, evt.Sender, evt.Sender)
-	content := event.MessageEventContent{
-		MsgType:       event.MsgText,
-		Body:          fmt.Sprintf("%s: %s", evt.Sender, gifURL),
-		Format:        event.FormatHTML,
-		FormattedBody: fmt.Sprintf("%s: <a href=%q>%s</a>", mention, gifURL, gifURL),
+	msg := matrixutil.NewMessage().
+		Mention(evt.Sender, matrixutil.DisplayNick(ctx, cli, evt.RoomID, evt.Sender.String())).
+		Text(": ").
+		Link(gifURL, "")
+	if _, err := command.Respond(ctx, cli, evt, msg.Content()); err != nil {
+		log.Printf("gif: failed to send %s: %v", gifURL, err)
 	}
-	cli.SendMessageEvent(ctx, evt.RoomID, event.EventMessage, content)
 }
 
-func fetchGif(apiKey, query string) (string, error) {
+func fetchGif(ctx context.Context, apiKey, query, lang string) (string, error) {
 	endpoint := fmt.Sprintf(
-		"https://tenor.googleapis.com/v2/search?q=%s&key=%s&limit=1",
+		"https://tenor.googleapis.com/v2/search?q=%s&key=%s&limit=1&locale=%s",
 		url.QueryEscape(query),
 		apiKey,
+		lang,
 	)
-	resp, err := http.Get(endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
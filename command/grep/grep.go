@@ -0,0 +1,115 @@
+package grep
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/history"
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+const maxResults = 10
+
+type Searcher interface {
+	Search(ctx context.Context, roomID id.RoomID, q history.SearchQuery) ([]history.HistoryMessage, error)
+}
+
+type GrepCmd struct {
+	History Searcher
+}
+
+func (*GrepCmd) Name() string      { return "grep" }
+func (*GrepCmd) Aliases() []string { return []string{} }
+func (*GrepCmd) Usage() string {
+	return "!grep <terms> [from:@user|from:nick] [before:YYYY-MM-DD] - Search this room's message history"
+}
+
+func (*GrepCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Search this room's message history", Examples: []string{"!grep deploy", "!grep lunch from:@alice:example.org", "!grep release before:2025-01-01"}}
+}
+
+func (g *GrepCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	q, err := parseQuery(args)
+	if err != nil {
+		command.Reply(ctx, cli, evt, err.Error())
+		return
+	}
+	if len(q.Terms) == 0 {
+		command.ReplyUsage(ctx, cli, evt, g.Usage())
+		return
+	}
+
+	msgs, err := g.History.Search(ctx, evt.RoomID, q)
+	if err != nil {
+		log.Printf("grep: search error: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	if len(msgs) == 0 {
+		command.Reply(ctx, cli, evt, "No matching messages.")
+		return
+	}
+
+	items := make([]*matrixutil.Message, len(msgs))
+	for i, m := range msgs {
+		when := time.UnixMilli(m.Timestamp).UTC().Format("2006-01-02 15:04")
+		items[i] = matrixutil.NewMessage().
+			Link(eventLink(evt.RoomID, m.EventID), when).
+			Textf(" <%s> %s", m.Sender, firstLine(m.Body))
+	}
+	content := matrixutil.NewMessage().Textf("%d matching messages:", len(msgs)).List(items...).Content()
+	content.MsgType = event.MsgNotice
+	if _, err := command.Respond(ctx, cli, evt, content); err != nil {
+		log.Printf("grep: failed to send results: %v", err)
+	}
+}
+
+// parseQuery splits args into search terms and the from: and before: filters.
+func parseQuery(args []string) (history.SearchQuery, error) {
+	q := history.SearchQuery{Limit: maxResults}
+	for _, a := range args {
+		if v, ok := strings.CutPrefix(a, "from:"); ok && v != "" {
+			// A bare nick may start with @ too; only MXIDs have a server.
+			if strings.HasPrefix(v, "@") && strings.Contains(v, ":") {
+				if _, err := command.ParseUserID(v); err != nil {
+					return q, fmt.Errorf("Invalid from: %v", err)
+				}
+			}
+			q.From = v
+			continue
+		}
+		if v, ok := strings.CutPrefix(a, "before:"); ok && v != "" {
+			t, err := time.ParseInLocation(time.DateOnly, v, time.UTC)
+			if err != nil {
+				return q, fmt.Errorf("Invalid date %q, use YYYY-MM-DD", v)
+			}
+			q.Before = t
+			continue
+		}
+		q.Terms = append(q.Terms, a)
+	}
+	return q, nil
+}
+
+func eventLink(roomID id.RoomID, eventID id.EventID) string {
+	return roomID.EventURI(eventID).MatrixToURL()
+}
+
+func firstLine(s string) string {
+	line, _, cut := strings.Cut(s, "\n")
+	if r := []rune(line); len(r) > 200 {
+		line, cut = string(r[:200]), true
+	}
+	if cut {
+		line += "…"
+	}
+	return line
+}
@@ -0,0 +1,260 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+// Categories group commands in the !help overview, in this order. Commands
+// without a Doc are listed under CategoryOther.
+const (
+	CategoryGames = "Games"
+	CategoryFun   = "Fun"
+	CategoryTools = "Tools"
+	CategoryRoom  = "Room"
+	CategoryBot   = "Bot"
+	CategoryOther = "Other"
+)
+
+var categories = []string{CategoryGames, CategoryFun, CategoryTools, CategoryRoom, CategoryBot, CategoryOther}
+
+// Doc describes a command for !help: a one-line summary for the overview,
+// and examples for !help <command>.
+type Doc struct {
+	Category string
+	Summary  string
+	Examples []string
+}
+
+// Documented is implemented by commands with help beyond their usage.
+type Documented interface {
+	Doc() Doc
+}
+
+func docOf(cmd Command) Doc {
+	var d Doc
+	if dc, ok := cmd.(Documented); ok {
+		d = dc.Doc()
+	}
+	if !slices.Contains(categories, d.Category) {
+		d.Category = CategoryOther
+	}
+	if d.Summary == "" {
+		_, d.Summary = splitUsage(strings.SplitN(cmd.Usage(), "\n", 2)[0])
+	}
+	return d
+}
+
+// splitUsage splits a usage line into the syntax and its description, which
+// are separated by a dash.
+func splitUsage(line string) (syntax, desc string) {
+	for _, sep := range []string{" — ", " - "} {
+		if s, d, ok := strings.Cut(line, sep); ok {
+			return s, d
+		}
+	}
+	return line, ""
+}
+
+type HelpCmd struct{}
+
+func (h *HelpCmd) Name() string      { return "help" }
+func (h *HelpCmd) Aliases() []string { return []string{} }
+func (h *HelpCmd) Usage() string {
+	return "!help [command] - Show available commands, or details and examples for one"
+}
+
+func (h *HelpCmd) Doc() Doc {
+	return Doc{Category: CategoryBot, Summary: "Show available commands", Examples: []string{"!help", "!help weather"}}
+}
+
+func (h *HelpCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) > 1 {
+		ReplyUsage(ctx, cli, evt, h.Usage())
+		return
+	}
+	if len(args) == 1 {
+		h.command(ctx, cli, evt, strings.TrimPrefix(args[0], RoomSettingsFrom(ctx).CommandPrefix()))
+		return
+	}
+	h.overview(ctx, cli, evt)
+}
+
+// overview lists the commands enabled in the room by category, followed by
+// the room's own commands.
+func (h *HelpCmd) overview(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	settings := RoomSettingsFrom(ctx)
+	prefix := settings.CommandPrefix()
+	byCategory := make(map[string][]Command)
+	for _, cmd := range Registry {
+		if settings.Enabled(cmd) {
+			cat := docOf(cmd).Category
+			byCategory[cat] = append(byCategory[cat], cmd)
+		}
+	}
+
+	msg := matrixutil.NewMessage()
+	for _, cat := range categories {
+		cmds := byCategory[cat]
+		if len(cmds) == 0 {
+			continue
+		}
+		items := make([]*matrixutil.Message, len(cmds))
+		for i, cmd := range cmds {
+			item := matrixutil.NewMessage().Code(prefix + cmd.Name())
+			for _, a := range cmd.Aliases() {
+				item.Text(", ").Code(prefix + a)
+			}
+			items[i] = item.Text(" — " + docOf(cmd).Summary)
+		}
+		msg.Bold(cat).List(items...)
+	}
+
+	var custom []string
+	for _, r := range resolvers {
+		custom = append(custom, r.Names(evt.RoomID)...)
+	}
+	if len(custom) > 0 {
+		slices.Sort(custom)
+		for i, c := range custom {
+			custom[i] = prefix + c
+		}
+		msg.Bold("This room").List(matrixutil.NewMessage().Code(strings.Join(custom, " ")))
+	}
+
+	msg.Textf("Type %shelp <command> for details and examples.", prefix)
+	content := msg.Content()
+	content.MsgType = event.MsgNotice
+	_, err := Respond(ctx, cli, evt, content)
+	if err != nil {
+		log.Printf("command: error sending help: %v", err)
+	}
+}
+
+// command shows the full usage of one command: every form and subcommand
+// with the permissions they need, its aliases and examples.
+func (h *HelpCmd) command(ctx context.Context, cli *mautrix.Client, evt *event.Event, name string) {
+	cmd := LookupIn(evt.RoomID, name)
+	if cmd == nil || !RoomSettingsFrom(ctx).Enabled(cmd) {
+		msg := fmt.Sprintf("Unknown command %q.", name)
+		if s := Suggestions(ctx, evt.RoomID, name); len(s) > 0 {
+			msg += fmt.Sprintf(" Did you mean %s?", strings.Join(s, " or "))
+		}
+		Reply(ctx, cli, evt, msg)
+		return
+	}
+	prefix := RoomSettingsFrom(ctx).CommandPrefix()
+	doc := docOf(cmd)
+
+	type usage struct {
+		line, note string
+	}
+	var usages []usage
+	if sc, ok := cmd.(Subcommander); ok {
+		r := sc.Router()
+		for line := range strings.SplitSeq(r.DefaultUsage, "\n") {
+			if line != "" {
+				usages = append(usages, usage{line: line})
+			}
+		}
+		for _, sub := range r.Subcommands {
+			var notes []string
+			if len(sub.Aliases) > 0 {
+				notes = append(notes, "aliases: "+strings.Join(sub.Aliases, ", "))
+			}
+			if sub.Permission.restricted() {
+				notes = append(notes, sub.Permission.String())
+			}
+			usages = append(usages, usage{sub.Usage, strings.Join(notes, "; ")})
+		}
+	} else {
+		for line := range strings.SplitSeq(cmd.Usage(), "\n") {
+			usages = append(usages, usage{line: line})
+		}
+	}
+
+	msg := matrixutil.NewMessage().Bold(prefix + cmd.Name()).Text(" — " + doc.Summary)
+	if aliases := cmd.Aliases(); len(aliases) > 0 {
+		msg.Line().Text("Aliases: ").Code(prefix + strings.Join(aliases, ", "+prefix))
+	}
+	if r, ok := cmd.(Restricted); ok && r.Permission().restricted() {
+		msg.Line().Text("Requires " + r.Permission().String())
+	}
+
+	items := make([]*matrixutil.Message, len(usages))
+	for i, u := range usages {
+		item := matrixutil.NewMessage()
+		items[i] = item
+		if !strings.HasPrefix(u.line, DefaultPrefix) {
+			// A remark rather than a form of the command.
+			item.Text(u.line)
+			continue
+		}
+		syntax, desc := splitUsage(Prefixed(ctx, u.line))
+		item.Code(syntax)
+		if desc != "" {
+			item.Text(" — " + desc)
+		}
+		if u.note != "" {
+			item.Text(" ").Italic("(" + u.note + ")")
+		}
+	}
+	msg.Line().Bold("Usage").List(items...)
+
+	if len(doc.Examples) > 0 {
+		examples := make([]*matrixutil.Message, len(doc.Examples))
+		for i, ex := range doc.Examples {
+			examples[i] = matrixutil.NewMessage().Code(Prefixed(ctx, ex))
+		}
+		msg.Bold("Examples").List(examples...)
+	}
+
+	content := msg.Content()
+	content.MsgType = event.MsgNotice
+	_, err := Respond(ctx, cli, evt, content)
+	if err != nil {
+		log.Printf("command: error sending help for %s: %v", cmd.Name(), err)
+	}
+}
+
+// Suggestions returns the commands, as called with the room's prefix, that
+// the unknown name was probably meant to be. Very short names get none, as
+// they are more often not meant as commands at all.
+func Suggestions(ctx context.Context, roomID id.RoomID, name string) []string {
+	name = strings.ToLower(name)
+	if len([]rune(name)) < 3 {
+		return nil
+	}
+	settings := RoomSettingsFrom(ctx)
+	var candidates []string
+	for _, cmd := range Registry {
+		if settings.Enabled(cmd) {
+			candidates = append(candidates, cmd.Name())
+			candidates = append(candidates, cmd.Aliases()...)
+		}
+	}
+	for _, r := range resolvers {
+		candidates = append(candidates, r.Names(roomID)...)
+	}
+	// Aliases of one or two letters are close to nearly everything.
+	candidates = slices.DeleteFunc(candidates, func(c string) bool { return len(c) < 3 })
+
+	s := Suggest(name, candidates)
+	s = slices.Compact(s)
+	if len(s) > 3 {
+		s = s[:3]
+	}
+	for i := range s {
+		s[i] = settings.CommandPrefix() + s[i]
+	}
+	return s
+}
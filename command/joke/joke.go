@@ -8,6 +8,8 @@ import (
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type JokeCmd struct{}
@@ -16,18 +18,26 @@ func (*JokeCmd) Name() string      { return "joke" }
 func (*JokeCmd) Aliases() []string { return []string{} }
 func (*JokeCmd) Usage() string     { return "!joke - Tell a random joke" }
 
+func (*JokeCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryFun, Summary: "Tell a random joke"}
+}
+
 func (*JokeCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	joke, err := fetchJoke()
+	joke, err := fetchJoke(ctx)
 	if err != nil {
-		cli.SendText(ctx, evt.RoomID, fmt.Sprintf("error: %v", err))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("error: %v", err))
 		return
 	}
-	cli.SendText(ctx, evt.RoomID, joke)
+	command.Reply(ctx, cli, evt, joke)
 }
 
-func fetchJoke() (string, error) {
+func fetchJoke(ctx context.Context) (string, error) {
 	const url = "https://v2.jokeapi.dev/joke/Programming"
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,512 @@
+package command
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/attachment"
+	"maunium.net/go/mautrix/event"
+)
+
+// Output modes for replies too long for one message.
+const (
+	// OutputSplit sends the reply as several messages. Formatted replies are
+	// cut between lines, list items and table rows, so that every page keeps
+	// its formatting.
+	OutputSplit = "split"
+	// OutputFile uploads the reply as a .txt or .html file.
+	OutputFile = "file"
+)
+
+const (
+	DefaultMaxLines = 40
+	MinMaxLines     = 5
+	MaxMaxLines     = 200
+
+	// maxBytes bounds the bodies of one message, well under the 64 KiB limit
+	// on events.
+	maxBytes = 16 * 1024
+	// maxPages is the most messages a reply is split into. Longer replies are
+	// uploaded, whatever the room's mode.
+	maxPages = 5
+	// summaryLen bounds the first line quoted next to an uploaded reply.
+	summaryLen = 100
+)
+
+var fileNameRe = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// oversized reports whether content needs the room's output policy.
+func oversized(ctx context.Context, content *event.MessageEventContent) bool {
+	if content.MsgType != event.MsgText && content.MsgType != event.MsgNotice {
+		return false
+	}
+	lines := strings.Count(content.Body, "\n") + 1
+	return lines > RoomSettingsFrom(ctx).LineLimit() || len(content.Body)+len(content.FormattedBody) > maxBytes
+}
+
+// respondLong sends an oversized reply as the room wants it: split into
+// pages, or uploaded with a summary. Its relation and mentions are already
+// set. The first message sent is returned.
+func respondLong(ctx context.Context, cli *mautrix.Client, evt *event.Event, content *event.MessageEventContent) (*mautrix.RespSendEvent, error) {
+	settings := RoomSettingsFrom(ctx)
+	if settings.OutputMode() == OutputSplit {
+		if pages, ok := split(content, settings.LineLimit()); ok && len(pages) <= maxPages {
+			return sendPages(ctx, cli, evt, content, pages)
+		}
+	}
+	file, err := upload(ctx, cli, evt, content)
+	if err != nil {
+		// Plain pages still beat no reply at all.
+		log.Printf("command: error uploading reply in %s: %v", evt.RoomID, err)
+		pages := plainPages(paginate(content.Body, settings.LineLimit()))
+		if len(pages) > maxPages {
+			pages = pages[:maxPages]
+			pages[maxPages-1].plain += "\n… (truncated)"
+		}
+		return sendPages(ctx, cli, evt, content, pages)
+	}
+	return send(ctx, cli, evt.RoomID, file)
+}
+
+// page is one message of a split reply. html is empty for plain replies.
+type page struct {
+	plain, html string
+}
+
+// split cuts content into pages of at most maxLines lines, keeping its
+// formatting. It reports false when formatted content can't be cut that way.
+func split(content *event.MessageEventContent, maxLines int) ([]page, bool) {
+	if formatted(content) {
+		return paginateHTML(content.Body, content.FormattedBody, maxLines)
+	}
+	return plainPages(paginate(content.Body, maxLines)), true
+}
+
+func plainPages(texts []string) []page {
+	pages := make([]page, len(texts))
+	for i, text := range texts {
+		pages[i].plain = text
+	}
+	return pages
+}
+
+func formatted(content *event.MessageEventContent) bool {
+	return content.Format == event.FormatHTML && content.FormattedBody != ""
+}
+
+// sendPages sends each page as its own message. Only the first one notifies
+// anyone.
+func sendPages(ctx context.Context, cli *mautrix.Client, evt *event.Event, content *event.MessageEventContent, pages []page) (*mautrix.RespSendEvent, error) {
+	var first *mautrix.RespSendEvent
+	for i, page := range pages {
+		pc := &event.MessageEventContent{
+			MsgType:   content.MsgType,
+			Body:      fmt.Sprintf("%s\n(%d/%d)", page.plain, i+1, len(pages)),
+			RelatesTo: content.RelatesTo,
+			Mentions:  content.Mentions,
+		}
+		if page.html != "" {
+			sep := "<br>"
+			if endsBlock(page.html) {
+				sep = ""
+			}
+			pc.Format = event.FormatHTML
+			pc.FormattedBody = fmt.Sprintf("%s%s(%d/%d)", page.html, sep, i+1, len(pages))
+		}
+		if i > 0 {
+			pc.Mentions = &event.Mentions{}
+		}
+		resp, err := send(ctx, cli, evt.RoomID, pc)
+		if err != nil {
+			return first, err
+		}
+		if first == nil {
+			first = resp
+		}
+	}
+	return first, nil
+}
+
+// paginate splits text into pages of at most maxLines lines and maxBytes
+// bytes, cutting overlong lines where they have to be.
+func paginate(text string, maxLines int) []string {
+	var pages []string
+	var page []string
+	size := 0
+	flush := func() {
+		if len(page) > 0 {
+			pages = append(pages, strings.Join(page, "\n"))
+			page, size = nil, 0
+		}
+	}
+	for line := range strings.SplitSeq(text, "\n") {
+		for len(line) > maxBytes {
+			flush()
+			cut := maxBytes
+			for !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			pages = append(pages, line[:cut])
+			line = line[cut:]
+		}
+		if len(page) >= maxLines || size+len(line)+1 > maxBytes {
+			flush()
+		}
+		page = append(page, line)
+		size += len(line) + 1
+	}
+	flush()
+	return pages
+}
+
+// segment is a piece of a formatted reply that starts a line of its own: a
+// line of text, a list item or a table row.
+type segment struct {
+	html  string
+	lines int
+	// block numbers the list or table the segment belongs to, from 1; text
+	// has 0.
+	block int
+	// tag is the list's tag, or the table section the row is in.
+	tag string
+	// n is the item's position in its list.
+	n int
+}
+
+// paginateHTML splits a formatted reply into pages of at most maxLines lines
+// and maxBytes bytes, cutting only between segments so that every page is
+// valid HTML. It reports false when formattedBody doesn't line up with body
+// line for line, or has a segment too big for one page.
+func paginateHTML(body, formattedBody string, maxLines int) ([]page, bool) {
+	segs, ok := segments(formattedBody)
+	if !ok {
+		return nil, false
+	}
+	lines := strings.Split(body, "\n")
+	total := 0
+	for _, sg := range segs {
+		total += sg.lines
+	}
+	if total != len(lines) {
+		return nil, false
+	}
+
+	var pages []page
+	start, line, n, size := 0, 0, 0, 0
+	flush := func(end, endLine int) {
+		pages = append(pages, page{
+			plain: strings.Join(lines[line:endLine], "\n"),
+			html:  renderSegments(segs[start:end]),
+		})
+		start, line, n, size = end, endLine, 0, 0
+	}
+	pos := 0
+	for i, sg := range segs {
+		plainLen := len(strings.Join(lines[pos:pos+sg.lines], "\n")) + 1
+		if len(sg.html)+plainLen > maxBytes {
+			return nil, false
+		}
+		if i > start && (n+sg.lines > maxLines || size+len(sg.html)+plainLen > maxBytes) {
+			flush(i, pos)
+		}
+		n += sg.lines
+		size += len(sg.html) + plainLen
+		pos += sg.lines
+	}
+	flush(len(segs), pos)
+	return pages, true
+}
+
+// segments cuts the HTML of a Message into segments. Text lines end at <br>,
+// while lists and tables are cut into their items and rows. It reports false
+// for HTML it can't cut, such as nested lists.
+func segments(s string) ([]segment, bool) {
+	var segs []segment
+	var text strings.Builder
+	blocks := 0
+	flushText := func() {
+		if text.Len() > 0 {
+			segs = append(segs, segment{html: text.String(), lines: 1})
+			text.Reset()
+		}
+	}
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			text.WriteString(s)
+			break
+		}
+		text.WriteString(s[:i])
+		tag, ok := nextTag(s[i:])
+		if !ok {
+			return nil, false
+		}
+		s = s[i+len(tag):]
+		switch name := tagName(tag); name {
+		case "br":
+			segs = append(segs, segment{html: text.String(), lines: 1})
+			text.Reset()
+		case "ul", "ol":
+			flushText()
+			inner, rest, ok := element(s, name)
+			if !ok {
+				return nil, false
+			}
+			blocks++
+			items, ok := listItems(inner, blocks, name)
+			if !ok {
+				return nil, false
+			}
+			segs, s = append(segs, items...), rest
+		case "table":
+			flushText()
+			inner, rest, ok := element(s, name)
+			if !ok {
+				return nil, false
+			}
+			blocks++
+			rows, ok := tableRows(inner, blocks)
+			if !ok {
+				return nil, false
+			}
+			segs, s = append(segs, rows...), rest
+		default:
+			text.WriteString(tag)
+		}
+	}
+	flushText()
+	return segs, true
+}
+
+// listItems cuts a list's content into its items. An item takes a line, plus
+// one for each line break in it.
+func listItems(s string, block int, tag string) ([]segment, bool) {
+	var segs []segment
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		inner, rest, ok := child(s, "li")
+		if !ok || strings.Contains(inner, "<ul") || strings.Contains(inner, "<ol") || strings.Contains(inner, "<table") {
+			return nil, false
+		}
+		segs = append(segs, segment{
+			html:  inner,
+			lines: 1 + strings.Count(inner, "<br>"),
+			block: block,
+			tag:   tag,
+			n:     len(segs),
+		})
+		s = rest
+	}
+	return segs, len(segs) > 0
+}
+
+// tableRows cuts a table's content into its rows, one line each.
+func tableRows(s string, block int) ([]segment, bool) {
+	var segs []segment
+	rows := func(s, section string) bool {
+		for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+			inner, rest, ok := child(s, "tr")
+			if !ok {
+				return false
+			}
+			segs = append(segs, segment{html: inner, lines: 1, block: block, tag: section})
+			s = rest
+		}
+		return true
+	}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		tag, ok := nextTag(s)
+		if !ok {
+			return nil, false
+		}
+		switch name := tagName(tag); name {
+		case "thead", "tbody":
+			inner, rest, ok := element(s[len(tag):], name)
+			if !ok || !rows(inner, name) {
+				return nil, false
+			}
+			s = rest
+		case "tr":
+			inner, rest, ok := element(s[len(tag):], name)
+			if !ok {
+				return nil, false
+			}
+			segs = append(segs, segment{html: inner, lines: 1, block: block, tag: "tbody"})
+			s = rest
+		default:
+			return nil, false
+		}
+	}
+	return segs, len(segs) > 0
+}
+
+// renderSegments puts segments back together, reopening the lists and
+// tables they were cut from. Ordered lists carry on with their numbering.
+func renderSegments(segs []segment) string {
+	var b strings.Builder
+	for i, sg := range segs {
+		first := i == 0 || segs[i-1].block != sg.block
+		last := i == len(segs)-1 || segs[i+1].block != sg.block
+		switch {
+		case sg.block == 0:
+			if i > 0 && segs[i-1].block == 0 {
+				b.WriteString("<br>")
+			}
+			b.WriteString(sg.html)
+		case sg.tag == "ul" || sg.tag == "ol":
+			if first {
+				if sg.tag == "ol" && sg.n > 0 {
+					fmt.Fprintf(&b, `<ol start="%d">`, sg.n+1)
+				} else {
+					b.WriteString("<" + sg.tag + ">")
+				}
+			}
+			b.WriteString("<li>" + sg.html + "</li>")
+			if last {
+				b.WriteString("</" + sg.tag + ">")
+			}
+		default:
+			if first {
+				b.WriteString("<table><" + sg.tag + ">")
+			} else if segs[i-1].tag != sg.tag {
+				b.WriteString("</" + segs[i-1].tag + "><" + sg.tag + ">")
+			}
+			b.WriteString("<tr>" + sg.html + "</tr>")
+			if last {
+				b.WriteString("</" + sg.tag + "></table>")
+			}
+		}
+	}
+	return b.String()
+}
+
+// endsBlock reports whether html ends with a list or table, which already
+// end their line.
+func endsBlock(html string) bool {
+	return strings.HasSuffix(html, "</ul>") || strings.HasSuffix(html, "</ol>") || strings.HasSuffix(html, "</table>")
+}
+
+// child reads the element named name at the start of s, returning its
+// content and what follows it.
+func child(s, name string) (inner, rest string, ok bool) {
+	tag, ok := nextTag(s)
+	if !ok || tagName(tag) != name {
+		return "", "", false
+	}
+	return element(s[len(tag):], name)
+}
+
+// element finds the end of the element named name whose opening tag was just
+// read from s, returning its content and what follows its closing tag.
+func element(s, name string) (inner, rest string, ok bool) {
+	depth := 1
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		tag, ok := nextTag(s[i:])
+		if !ok {
+			break
+		}
+		switch tagName(tag) {
+		case name:
+			depth++
+		case "/" + name:
+			if depth--; depth == 0 {
+				return s[:i], s[i+len(tag):], true
+			}
+		}
+		i += len(tag)
+	}
+	return "", "", false
+}
+
+// nextTag returns the tag s starts with. Message escapes all text, so every
+// < starts one.
+func nextTag(s string) (string, bool) {
+	if !strings.HasPrefix(s, "<") {
+		return "", false
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 0 {
+		return "", false
+	}
+	return s[:end+1], true
+}
+
+// tagName is the lowercased name of tag, with a leading / for closing tags.
+func tagName(tag string) string {
+	name := strings.Trim(tag, "<>/")
+	if i := strings.IndexAny(name, " \t\n"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(name)
+	if strings.HasPrefix(tag, "</") {
+		name = "/" + name
+	}
+	return name
+}
+
+// upload stores the reply in the media repo, encrypted when the room is, and
+// returns the file message that links it, captioned with its first line.
+func upload(ctx context.Context, cli *mautrix.Client, evt *event.Event, content *event.MessageEventContent) (*event.MessageEventContent, error) {
+	base := "reply"
+	if inv, ok := InvocationFrom(ctx); ok && fileNameRe.MatchString(inv.Name) {
+		base = inv.Name
+	}
+	name, data, mime := base+".txt", []byte(content.Body), "text/plain; charset=utf-8"
+	if formatted(content) {
+		name = base + ".html"
+		data = fmt.Appendf(nil, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title></head><body>\n%s\n</body></html>\n", name, content.FormattedBody)
+		mime = "text/html; charset=utf-8"
+	}
+
+	file := &event.MessageEventContent{
+		MsgType:   event.MsgFile,
+		Body:      summary(content.Body),
+		FileName:  name,
+		Info:      &event.FileInfo{MimeType: mime, Size: len(data)},
+		RelatesTo: content.RelatesTo,
+		Mentions:  content.Mentions,
+	}
+	encrypted := false
+	if cli.Crypto != nil && cli.StateStore != nil {
+		var err error
+		if encrypted, err = cli.StateStore.IsEncrypted(ctx, evt.RoomID); err != nil {
+			return nil, err
+		}
+	}
+	if !encrypted {
+		resp, err := cli.UploadBytesWithName(ctx, data, mime, name)
+		if err != nil {
+			return nil, err
+		}
+		file.URL = resp.ContentURI.CUString()
+		return file, nil
+	}
+	ef := attachment.NewEncryptedFile()
+	ef.EncryptInPlace(data)
+	resp, err := cli.UploadBytesWithName(ctx, data, "application/octet-stream", name)
+	if err != nil {
+		return nil, err
+	}
+	file.File = &event.EncryptedFileInfo{EncryptedFile: *ef, URL: resp.ContentURI.CUString()}
+	return file, nil
+}
+
+// summary captions an uploaded reply with its first line and its length.
+func summary(body string) string {
+	first, _, _ := strings.Cut(body, "\n")
+	if utf8.RuneCountInString(first) > summaryLen {
+		first = string([]rune(first)[:summaryLen-1]) + "…"
+	}
+	lines := strings.Count(body, "\n") + 1
+	return fmt.Sprintf("%s (%d lines, full reply attached)", cmp.Or(first, "Reply"), lines)
+}
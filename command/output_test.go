@@ -0,0 +1,114 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+func TestPaginateHTML(t *testing.T) {
+	items := func(n int) []*matrixutil.Message {
+		var ms []*matrixutil.Message
+		for i := range n {
+			ms = append(ms, matrixutil.NewMessage().Textf("item <%d>", i+1))
+		}
+		return ms
+	}
+	rows := func(n int) [][]*matrixutil.Message {
+		var rs [][]*matrixutil.Message
+		for i := range n {
+			rs = append(rs, []*matrixutil.Message{matrixutil.NewMessage().Textf("r%d", i+1), matrixutil.NewMessage().Text("x")})
+		}
+		return rs
+	}
+
+	tests := []struct {
+		name     string
+		msg      *matrixutil.Message
+		maxLines int
+		want     []page
+	}{
+		{
+			name:     "lines",
+			msg:      matrixutil.NewMessage().Bold("a").Line().Text("b").Line().Text("c & d"),
+			maxLines: 2,
+			want: []page{
+				{plain: "a\nb", html: "<b>a</b><br>b"},
+				{plain: "c & d", html: "c &amp; d"},
+			},
+		},
+		{
+			name:     "blank line",
+			msg:      matrixutil.NewMessage().Text("a").Line().Line().Text("b"),
+			maxLines: 2,
+			want: []page{
+				{plain: "a\n", html: "a<br>"},
+				{plain: "b", html: "b"},
+			},
+		},
+		{
+			name:     "list",
+			msg:      matrixutil.NewMessage().Text("Title").List(items(3)...).Text("end"),
+			maxLines: 2,
+			want: []page{
+				{plain: "Title\n• item <1>", html: "Title<ul><li>item &lt;1&gt;</li></ul>"},
+				{plain: "• item <2>\n• item <3>", html: "<ul><li>item &lt;2&gt;</li><li>item &lt;3&gt;</li></ul>"},
+				{plain: "end", html: "end"},
+			},
+		},
+		{
+			name:     "ordered list keeps numbering",
+			msg:      matrixutil.NewMessage().OrderedList(items(3)...),
+			maxLines: 2,
+			want: []page{
+				{plain: "1. item <1>\n2. item <2>", html: "<ol><li>item &lt;1&gt;</li><li>item &lt;2&gt;</li></ol>"},
+				{plain: "3. item <3>", html: `<ol start="3"><li>item &lt;3&gt;</li></ol>`},
+			},
+		},
+		{
+			name:     "multi-line item",
+			msg:      matrixutil.NewMessage().List(matrixutil.NewMessage().Text("a").Line().Text("b"), matrixutil.NewMessage().Text("c")),
+			maxLines: 2,
+			want: []page{
+				{plain: "• a\n  b", html: "<ul><li>a<br>b</li></ul>"},
+				{plain: "• c", html: "<ul><li>c</li></ul>"},
+			},
+		},
+		{
+			name:     "table",
+			msg:      matrixutil.NewMessage().Table([]string{"name", "v"}, rows(3)...),
+			maxLines: 2,
+			want: []page{
+				{plain: "name  v\nr1    x", html: "<table><thead><tr><th>name</th><th>v</th></tr></thead><tbody><tr><td>r1</td><td>x</td></tr></tbody></table>"},
+				{plain: "r2    x\nr3    x", html: "<table><tbody><tr><td>r2</td><td>x</td></tr><tr><td>r3</td><td>x</td></tr></tbody></table>"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := paginateHTML(tt.msg.Plain(), tt.msg.HTML(), tt.maxLines)
+			if !ok {
+				t.Fatalf("paginateHTML(%q) failed", tt.msg.HTML())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("paginateHTML(%q) =\n%q\nwant\n%q", tt.msg.HTML(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateHTMLRefuses(t *testing.T) {
+	nested := matrixutil.NewMessage().List(matrixutil.NewMessage().Text("a").List(matrixutil.NewMessage().Text("b")))
+	if _, ok := paginateHTML(nested.Plain(), nested.HTML(), 1); ok {
+		t.Error("paginateHTML split a nested list")
+	}
+	if _, ok := paginateHTML("a\nb\nc", "a<br>b", 1); ok {
+		t.Error("paginateHTML split HTML that doesn't match its body")
+	}
+	huge := strings.Repeat("x", maxBytes)
+	if _, ok := paginateHTML(huge, huge, 1); ok {
+		t.Error("paginateHTML split a line over maxBytes")
+	}
+}
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+// Named roles a command can require instead of a raw power level. Bot admins
+// from the config pass every check.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleBotAdmin  = "bot-admin"
+)
+
+// Permission is what a user needs to run a command or subcommand: a minimum
+// power level in the room, or a named role. The zero value lets anyone run it.
+type Permission struct {
+	Level int
+	Role  string
+}
+
+func (p Permission) restricted() bool {
+	return p.Level > 0 || p.Role != ""
+}
+
+// level is the power level the permission asks for, or -1 when no level is
+// enough, as for RoleBotAdmin.
+func (p Permission) level() int {
+	switch p.Role {
+	case "":
+		return p.Level
+	case RoleModerator:
+		return matrixutil.ModeratorLevel
+	case RoleAdmin:
+		return matrixutil.AdminLevel
+	}
+	return -1
+}
+
+func (p Permission) String() string {
+	switch {
+	case p.Role == RoleBotAdmin:
+		return "bot admins only"
+	case p.Role != "":
+		return fmt.Sprintf("%s, power level %d", p.Role, p.level())
+	}
+	return fmt.Sprintf("power level %d", p.Level)
+}
+
+// Restricted is implemented by commands that need a permission to run at all.
+type Restricted interface {
+	Permission() Permission
+}
+
+// Check reports whether the sender may run cmd with args, taking both the
+// command's permission and that of the subcommand args route to. The error
+// explains a denial and is meant to be shown to the user.
+func Check(ctx context.Context, cli *mautrix.Client, evt *event.Event, cmd Command, args []string) error {
+	what := RoomSettingsFrom(ctx).CommandPrefix() + cmd.Name()
+	var perms []Permission
+	if r, ok := cmd.(Restricted); ok {
+		perms = append(perms, r.Permission())
+	}
+	if sc, ok := cmd.(Subcommander); ok {
+		if sub, _ := sc.Router().Match(args); sub != nil {
+			perms = append(perms, sub.Permission)
+			what += " " + sub.Name
+		}
+	}
+	for _, p := range perms {
+		if err := authorize(ctx, cli, evt.RoomID, evt.Sender, p); err != nil {
+			return fmt.Errorf("Sorry, %s is restricted (%s): %w", what, p, err)
+		}
+	}
+	return nil
+}
+
+func authorize(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, user id.UserID, p Permission) error {
+	if !p.restricted() || matrixutil.IsBotAdmin(user) {
+		return nil
+	}
+	need := p.level()
+	if need < 0 {
+		return fmt.Errorf("you are not a bot admin")
+	}
+	pl, err := matrixutil.PowerLevels(ctx, cli, roomID)
+	if err != nil {
+		log.Printf("command: error loading power levels of %s: %v", roomID, err)
+		return fmt.Errorf("I couldn't check your power level")
+	}
+	if have := pl.GetUserLevel(user); have < need {
+		return fmt.Errorf("your power level is %d", have)
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type PingCmd struct{}
@@ -16,11 +18,15 @@ func (*PingCmd) Name() string      { return "ping" }
 func (*PingCmd) Aliases() []string { return []string{"p"} }
 func (*PingCmd) Usage() string     { return "!ping - Check bot latency" }
 
+func (*PingCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryBot, Summary: "Check bot latency", Examples: []string{"!ping"}}
+}
+
 func (c *PingCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
 	eventAge := time.Since(time.UnixMilli(evt.Timestamp))
 
 	sendStart := time.Now()
-	resp, err := cli.SendText(ctx, evt.RoomID, fmt.Sprintf(
+	resp, err := command.Reply(ctx, cli, evt, fmt.Sprintf(
 		"pong! event age: %s | send: measuring...",
 		formatLatency(eventAge),
 	))
@@ -47,6 +53,7 @@ func (c *PingCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.E
 			Type:    event.RelReplace,
 			EventID: resp.EventID,
 		},
+		Mentions: &event.Mentions{},
 	})
 	if err != nil {
 		log.Printf("cli.SendMessageEvent error: %v", err)
@@ -0,0 +1,99 @@
+package poll
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/rubyChan/command"
+)
+
+const (
+	kindDisclosed   = "org.matrix.msc3381.poll.disclosed"
+	kindUndisclosed = "org.matrix.msc3381.poll.undisclosed"
+)
+
+// pollSpec declares the options of !poll:
+//
+//	--multi [N]   allow up to N selections (all options when N is omitted)
+//	--secret      hide results until the poll closes (native polls only)
+//	--closes D    close the poll automatically after duration D
+//	--reactions   vote with keycap reactions instead of a native poll
+//	--native      use a native poll even if the room defaults to reactions
+//
+// The question and options follow, either separated by "|" or as quoted
+// words: !poll "Lunch?" "Pizza place" Sushi. Text with a "|" is taken as
+// typed after the flags, quotes, backslashes and dashes included.
+var pollSpec = &command.Spec{
+	Command: "poll",
+	Flags: []command.Flag{
+		{Name: "multi", Type: command.TypeInt, OptionalValue: true},
+		{Name: "secret", Type: command.TypeBool},
+		{Name: "closes", Type: command.TypeDuration},
+		{Name: "reactions", Type: command.TypeBool},
+		{Name: "native", Type: command.TypeBool},
+	},
+	Args: []command.Arg{
+		{Name: "question | options", Variadic: true},
+	},
+}
+
+type pollOptions struct {
+	multi    int
+	multiSet bool
+	secret   bool
+	closes   time.Duration
+
+	reactions bool
+	modeSet   bool
+}
+
+// parseOptions parses the !poll arguments into its options, the question
+// and the answer texts.
+func parseOptions(raw string) (pollOptions, string, []string, error) {
+	var (
+		o     pollOptions
+		a     *command.Args
+		parts []string
+		err   error
+	)
+	if strings.Contains(raw, "|") {
+		var rest string
+		a, rest, err = pollSpec.ParsePrefix(raw)
+		parts = strings.Split(rest, "|")
+	} else {
+		a, err = pollSpec.Parse(raw)
+		if err == nil {
+			parts = a.Strings("question | options")
+		}
+	}
+	if err != nil {
+		return o, "", nil, err
+	}
+	o.multiSet = a.Has("multi")
+	o.multi = a.Int("multi")
+	if o.multiSet && o.multi < 1 && !a.Bool("multi") {
+		return o, "", nil, fmt.Errorf("--multi needs a positive number")
+	}
+	o.secret = a.Bool("secret")
+	o.closes = a.Duration("closes")
+	if a.Bool("reactions") && a.Bool("native") {
+		return o, "", nil, fmt.Errorf("Use either --reactions or --native, not both")
+	}
+	o.reactions = a.Bool("reactions")
+	o.modeSet = o.reactions || a.Bool("native")
+
+	if len(parts) < 3 {
+		return o, "", nil, &command.UsageError{Spec: pollSpec, Msg: "A poll needs a question and at least two options"}
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return o, parts[0], parts[1:], nil
+}
+
+// answerID is the stable ID of the i-th answer of a poll.
+func answerID(i int) string {
+	return "opt" + strconv.Itoa(i+1)
+}
@@ -0,0 +1,84 @@
+package poll
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		raw      string
+		question string
+		choices  []string
+		secret   bool
+		multi    int
+		closes   time.Duration
+		wantErr  bool
+	}{
+		{
+			raw:      "Lunch? | Pizza | Sushi",
+			question: "Lunch?",
+			choices:  []string{"Pizza", "Sushi"},
+		},
+		{
+			raw:      `"Lunch?" "Pizza place" Sushi`,
+			question: "Lunch?",
+			choices:  []string{"Pizza place", "Sushi"},
+		},
+		{
+			raw:      "Best editor? | vim -u NONE | emacs -nw",
+			question: "Best editor?",
+			choices:  []string{"vim -u NONE", "emacs -nw"},
+		},
+		{
+			raw:      `Is it "good? | yes | no`,
+			question: `Is it "good?`,
+			choices:  []string{"yes", "no"},
+		},
+		{
+			raw:      `Where? | C:\tmp | D:\data`,
+			question: "Where?",
+			choices:  []string{`C:\tmp`, `D:\data`},
+		},
+		{
+			raw:      "--secret --multi 2 --closes 2h Pick | a | b | c",
+			question: "Pick",
+			choices:  []string{"a", "b", "c"},
+			secret:   true,
+			multi:    2,
+			closes:   2 * time.Hour,
+		},
+		{
+			raw:      "--multi Pick | a | b",
+			question: "Pick",
+			choices:  []string{"a", "b"},
+		},
+		{
+			raw:      "--secret Pick one -x -y",
+			question: "Pick",
+			choices:  []string{"one", "-x", "-y"},
+			secret:   true,
+		},
+		{raw: "Lunch? | Pizza", wantErr: true},
+		{raw: "--nope Lunch? | a | b", wantErr: true},
+		{raw: "--reactions --native Lunch? | a | b", wantErr: true},
+		{raw: `"Lunch? Pizza Sushi`, wantErr: true},
+	}
+	for _, tt := range tests {
+		o, question, choices, err := parseOptions(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOptions(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if question != tt.question || !slices.Equal(choices, tt.choices) {
+			t.Errorf("parseOptions(%q) = %q, %q; want %q, %q", tt.raw, question, choices, tt.question, tt.choices)
+		}
+		if o.secret != tt.secret || o.multi != tt.multi || o.closes != tt.closes {
+			t.Errorf("parseOptions(%q) options = %+v", tt.raw, o)
+		}
+	}
+}
@@ -2,75 +2,382 @@ package poll
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/internal/matrixutil"
+	"github.com/hionay/rubyChan/state"
 )
 
-type PollCmd struct{}
+type PollCmd struct {
+	store *state.Namespace
+	mu    sync.Mutex
+}
+
+func NewPollCmd(store *state.Namespace) *PollCmd {
+	return &PollCmd{store: store}
+}
 
 func (*PollCmd) Name() string      { return "poll" }
 func (*PollCmd) Aliases() []string { return []string{} }
-func (*PollCmd) Usage() string {
-	return "!poll <question> | <option1> | <option2> [| …] — Create a poll"
+func (c *PollCmd) Usage() string   { return c.Router().Usage() }
+
+func (*PollCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Run a poll", Examples: []string{"!poll Lunch? | Pizza | Sushi", "!poll --multi 2 --closes 2h \"Which days?\" Mon Tue Wed", "!poll results"}}
+}
+
+// Stateful keeps edits from running the command again. Every run opens a poll.
+func (*PollCmd) Stateful() bool { return true }
+
+func (c *PollCmd) Router() *command.Router {
+	return &command.Router{
+		Command:      "poll",
+		Default:      c.create,
+		DefaultUsage: pollSpec.Usage() + " — Create a poll (or quote the question and options instead of using |)",
+		FreeArgs:     true,
+		Subcommands: []command.Subcommand{
+			{Name: "results", Usage: "!poll results [id] — Show the current tally", Handler: c.results, MaxArgs: 1},
+			{Name: "mode", Usage: "!poll mode [native|reactions] — Show or set this room's default poll style", Handler: c.mode, MaxArgs: 1},
+			{Name: "close", Usage: "!poll close [id] — End a poll and post the final results", Handler: c.close, MaxArgs: 1},
+		},
+	}
 }
 
 func (c *PollCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	raw := strings.Join(args, " ")
-	parts := strings.Split(raw, "|")
-	if len(parts) < 3 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+c.Usage())
+	c.Router().Route(ctx, cli, evt, args)
+}
+
+func (c *PollCmd) create(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	opts, question, choices, err := parseOptions(command.ArgText(ctx, args))
+	if err != nil {
+		command.Reply(ctx, cli, evt, command.Prefixed(ctx, err.Error()))
 		return
 	}
+	maxSel := opts.multi
+	if maxSel == 0 || maxSel > len(choices) {
+		maxSel = len(choices)
+	}
+	if !opts.multiSet {
+		maxSel = 1
+	}
 
-	question := strings.TrimSpace(parts[0])
-	opts := parts[1:]
-	for i := range opts {
-		opts[i] = strings.TrimSpace(opts[i])
+	recAnswers := make([]answer, len(choices))
+	for i, choice := range choices {
+		recAnswers[i] = answer{ID: answerID(i), Text: choice}
 	}
 
-	answers := make([]map[string]any, len(opts))
-	for i, opt := range opts {
-		uid := strconv.FormatInt(time.Now().UnixNano()+int64(i), 36)
-		answers[i] = map[string]any{
-			"id":                      uid,
-			"org.matrix.msc1767.text": opt,
-		}
+	reactions := opts.reactions
+	if !opts.modeSet {
+		reactions = c.roomMode(evt.RoomID) == modeReactions
+	}
+	if reactions && opts.secret {
+		// Everyone sees the reaction counts, so nothing can be hidden.
+		command.Reply(ctx, cli, evt, "Reaction polls can't hide their results; use --native for a secret poll.")
+		return
+	}
+	if reactions && len(choices) > len(keycaps) {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Reaction polls support at most %d options.", len(keycaps)))
+		return
 	}
 
+	seq, err := c.store.NextSequence()
+	if err != nil {
+		log.Printf("poll: error allocating id: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	p := &pollRecord{
+		ID:            int64(seq),
+		RoomID:        evt.RoomID,
+		Creator:       evt.Sender,
+		Question:      question,
+		Answers:       recAnswers,
+		MaxSelections: maxSel,
+		Secret:        opts.secret,
+		Reactions:     reactions,
+		Votes:         make(map[id.UserID]vote),
+	}
+	if opts.closes > 0 {
+		p.ClosesAt = time.Now().Add(opts.closes)
+	}
+
+	if reactions {
+		p.EventID, err = c.startReactionPoll(ctx, cli, evt, p)
+	} else {
+		p.EventID, err = c.startNativePoll(ctx, cli, evt, p)
+	}
+	if err != nil {
+		log.Printf("Poll send error: %v", err)
+		return
+	}
+
+	if err := c.save(p); err != nil {
+		log.Printf("poll: error saving poll: %v", err)
+		return
+	}
+	if err := c.store.PutString(eventKey(p.EventID), strconv.FormatInt(p.ID, 10)); err != nil {
+		log.Printf("poll: error indexing poll: %v", err)
+	}
+	if err := c.store.PutString(latestKey(p.RoomID), strconv.FormatInt(p.ID, 10)); err != nil {
+		log.Printf("poll: error saving latest poll: %v", err)
+	}
+	if !p.ClosesAt.IsZero() {
+		c.armClose(ctx, cli, p)
+	}
+}
+
+// footer lists the poll's constraints for text renderings of it.
+func (p *pollRecord) footer() string {
+	var b strings.Builder
+	if p.MaxSelections > 1 {
+		fmt.Fprintf(&b, "\n(pick up to %d)", p.MaxSelections)
+	}
+	if p.Secret && !p.Reactions {
+		b.WriteString("\n(results hidden until the poll closes)")
+	}
+	if !p.ClosesAt.IsZero() {
+		fmt.Fprintf(&b, "\n(closes %s)", p.ClosesAt.Format(time.RFC1123))
+	}
+	return b.String()
+}
+
+func (c *PollCmd) startNativePoll(ctx context.Context, cli *mautrix.Client, evt *event.Event, p *pollRecord) (id.EventID, error) {
+	answers := make([]map[string]any, len(p.Answers))
 	var b strings.Builder
-	b.WriteString(question)
-	for i, opt := range opts {
-		b.WriteString(fmt.Sprintf("\n%d. %s", i+1, opt))
+	fmt.Fprintf(&b, "Poll #%d: %s", p.ID, p.Question)
+	for i, a := range p.Answers {
+		answers[i] = map[string]any{
+			"id":                      a.ID,
+			"org.matrix.msc1767.text": a.Text,
+		}
+		b.WriteString(fmt.Sprintf("\n%d. %s", i+1, a.Text))
 	}
+	b.WriteString(p.footer())
 	fallback := b.String()
 
+	kind := kindDisclosed
+	if p.Secret {
+		kind = kindUndisclosed
+	}
+
 	content := map[string]any{
 		"org.matrix.msc3381.poll.start": map[string]any{
 			"question": map[string]any{
-				"org.matrix.msc1767.text": question,
-				"body":                    question,
+				"org.matrix.msc1767.text": p.Question,
+				"body":                    p.Question,
 				"msgtype":                 "m.text",
 			},
-			"kind":           "org.matrix.msc3381.poll.disclosed",
-			"max_selections": 1,
+			"kind":           kind,
+			"max_selections": p.MaxSelections,
 			"answers":        answers,
 		},
 		"org.matrix.msc1767.text": fallback,
+		"m.relates_to":            command.ReplyRelation(evt),
+		"m.mentions":              event.Mentions{UserIDs: []id.UserID{evt.Sender}},
 	}
 
-	_, err := cli.SendMessageEvent(
+	resp, err := cli.SendMessageEvent(
 		ctx,
-		evt.RoomID,
+		p.RoomID,
 		event.EventUnstablePollStart,
 		content,
 	)
 	if err != nil {
-		log.Printf("Poll send error: %v", err)
+		return "", err
 	}
+	command.TrackReply(ctx, p.RoomID, resp.EventID)
+	return resp.EventID, nil
+}
+
+// Restore re-arms the auto-close timers of open polls, ending right away the
+// ones whose deadline passed while the bot was down.
+func (c *PollCmd) Restore(ctx context.Context, cli *mautrix.Client) error {
+	var timed []*pollRecord
+	err := c.store.ForEach("poll:", func(key string, value []byte) error {
+		p := &pollRecord{}
+		if err := json.Unmarshal(value, p); err != nil {
+			log.Printf("poll: skipping corrupt entry %s: %v", key, err)
+			return nil
+		}
+		if !p.Closed && !p.ClosesAt.IsZero() {
+			timed = append(timed, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range timed {
+		c.armClose(ctx, cli, p)
+	}
+	return nil
+}
+
+func (c *PollCmd) armClose(ctx context.Context, cli *mautrix.Client, p *pollRecord) {
+	// The timer outlives the command that created it.
+	ctx = context.WithoutCancel(ctx)
+	pid := p.ID
+	time.AfterFunc(time.Until(p.ClosesAt), func() {
+		c.end(ctx, cli, pid)
+	})
+}
+
+// HandlePollResponse records a vote on one of the bot's polls.
+func (c *PollCmd) HandlePollResponse(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	content, ok := evt.Content.Parsed.(*event.PollResponseEventContent)
+	if !ok {
+		return
+	}
+	pollEvt := content.RelatesTo.EventID
+	if pollEvt == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, err := c.loadByEvent(pollEvt)
+	if err != nil {
+		log.Printf("poll: error loading poll for %s: %v", pollEvt, err)
+		return
+	}
+	if p == nil || p.RoomID != evt.RoomID {
+		return
+	}
+	if !p.record(evt.Sender, content.Response.Answers, evt.Timestamp) {
+		return
+	}
+	if err := c.save(p); err != nil {
+		log.Printf("poll: error saving vote: %v", err)
+	}
+}
+
+func (c *PollCmd) results(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	c.mu.Lock()
+	p, errMsg := c.find(evt.RoomID, args)
+	c.mu.Unlock()
+	if p == nil {
+		command.Reply(ctx, cli, evt, errMsg)
+		return
+	}
+	if _, err := command.Respond(ctx, cli, evt, p.results().Content()); err != nil {
+		log.Printf("poll: failed to send results: %v", err)
+	}
+}
+
+func (c *PollCmd) close(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	c.mu.Lock()
+	p, errMsg := c.find(evt.RoomID, args)
+	c.mu.Unlock()
+	if p == nil {
+		command.Reply(ctx, cli, evt, errMsg)
+		return
+	}
+	if p.Closed {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Poll #%d is already closed.", p.ID))
+		return
+	}
+	if p.Creator != evt.Sender && !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Only the creator of poll #%d or a moderator can close it.", p.ID))
+		return
+	}
+	c.end(ctx, cli, p.ID)
+}
+
+// end closes the poll, sends its poll.end event and posts the final results.
+func (c *PollCmd) end(ctx context.Context, cli *mautrix.Client, pid int64) {
+	c.mu.Lock()
+	p, err := c.load(pid)
+	if err != nil || p == nil || p.Closed {
+		c.mu.Unlock()
+		if err != nil {
+			log.Printf("poll: error loading poll #%d: %v", pid, err)
+		}
+		return
+	}
+	p.Closed = true
+	p.ClosedAt = time.Now().UnixMilli()
+	if err := c.save(p); err != nil {
+		log.Printf("poll: error saving poll #%d: %v", pid, err)
+	}
+	c.mu.Unlock()
+
+	if !p.Reactions {
+		if _, err := cli.SendMessageEvent(ctx, p.RoomID, event.EventUnstablePollEnd, p.endContent()); err != nil {
+			log.Printf("poll: failed to send poll end for #%d: %v", pid, err)
+		}
+	}
+	c.sendResults(ctx, cli, p)
+}
+
+func (c *PollCmd) sendResults(ctx context.Context, cli *mautrix.Client, p *pollRecord) {
+	if _, err := cli.SendMessageEvent(ctx, p.RoomID, event.EventMessage, p.results().Content()); err != nil {
+		log.Printf("poll: failed to send results: %v", err)
+	}
+}
+
+// find resolves the poll named by args, or the room's latest poll. When none
+// is found it returns a message explaining why. Callers hold c.mu.
+func (c *PollCmd) find(roomID id.RoomID, args []string) (*pollRecord, string) {
+	var idStr string
+	if len(args) > 0 {
+		idStr = strings.TrimPrefix(args[0], "#")
+	} else {
+		s, err := c.store.GetString(latestKey(roomID))
+		if err != nil {
+			log.Printf("poll: error loading latest poll: %v", err)
+			return nil, "Internal error"
+		}
+		if s == "" {
+			return nil, "No polls in this room yet."
+		}
+		idStr = s
+	}
+	pid, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, "Invalid poll ID"
+	}
+	p, err := c.load(pid)
+	if err != nil {
+		log.Printf("poll: error loading poll #%d: %v", pid, err)
+		return nil, "Internal error"
+	}
+	if p == nil || p.RoomID != roomID {
+		return nil, fmt.Sprintf("No poll #%d found", pid)
+	}
+	return p, ""
+}
+
+func (c *PollCmd) load(pid int64) (*pollRecord, error) {
+	p := &pollRecord{}
+	if err := c.store.GetJSON(pollKey(pid), p); err != nil || p.ID == 0 {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *PollCmd) loadByEvent(evtID id.EventID) (*pollRecord, error) {
+	s, err := c.store.GetString(eventKey(evtID))
+	if err != nil || s == "" {
+		return nil, err
+	}
+	pid, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return c.load(pid)
+}
+
+func (c *PollCmd) save(p *pollRecord) error {
+	return c.store.PutJSON(pollKey(p.ID), p)
 }
@@ -0,0 +1,226 @@
+package poll
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+const (
+	modeNative    = "native"
+	modeReactions = "reactions"
+)
+
+// keycaps are the reactions offered on a reaction poll, one per option.
+var keycaps = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+
+// keycapIndex maps a reaction key to its option index, or -1. Clients do not
+// agree on the variation selector, so it is ignored.
+func keycapIndex(key string) int {
+	key = strings.ReplaceAll(key, "\ufe0f", "")
+	return slices.IndexFunc(keycaps, func(k string) bool {
+		return strings.ReplaceAll(k, "\ufe0f", "") == key
+	})
+}
+
+type reactionVote struct {
+	EventID   id.EventID `json:"event_id"`
+	Answer    string     `json:"answer"`
+	Timestamp int64      `json:"ts"`
+}
+
+func reactionKey(evtID id.EventID) string { return "reaction:" + evtID.String() }
+func modeKey(roomID id.RoomID) string     { return "mode:" + roomID.String() }
+
+// startReactionPoll posts the poll as a numbered message and seeds it with
+// one keycap reaction per option, for clients without MSC3381 support.
+func (c *PollCmd) startReactionPoll(ctx context.Context, cli *mautrix.Client, evt *event.Event, p *pollRecord) (id.EventID, error) {
+	msg := matrixutil.NewMessage().Text("📊 ").Bold(fmt.Sprintf("Poll #%d", p.ID)).Text(": " + p.Question)
+	for i, a := range p.Answers {
+		msg.Line().Text(keycaps[i] + " " + a.Text)
+	}
+	msg.Text(p.footer() + "\nVote by reacting with the option's number.")
+
+	resp, err := command.Respond(ctx, cli, evt, msg.Content())
+	if err != nil {
+		return "", err
+	}
+	for i := range p.Answers {
+		if _, err := cli.SendReaction(ctx, p.RoomID, resp.EventID, keycaps[i]); err != nil {
+			log.Printf("poll: failed to seed reaction %s on #%d: %v", keycaps[i], p.ID, err)
+		}
+	}
+	return resp.EventID, nil
+}
+
+// recordReaction adds a keycap reaction to the user's vote. A user holds at
+// most MaxSelections answers, so a newer reaction displaces the oldest one;
+// on a single-choice poll that means changing the vote.
+func (p *pollRecord) recordReaction(user id.UserID, rv reactionVote) bool {
+	if p.Closed && rv.Timestamp > p.ClosedAt {
+		return false
+	}
+	if p.Votes == nil {
+		p.Votes = make(map[id.UserID]vote)
+	}
+	v := p.Votes[user]
+	if slices.ContainsFunc(v.Reactions, func(x reactionVote) bool { return x.EventID == rv.EventID }) {
+		return false
+	}
+	v.Reactions = append(v.Reactions, rv)
+	slices.SortStableFunc(v.Reactions, func(a, b reactionVote) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+	p.Votes[user] = p.reactionTally(v)
+	return true
+}
+
+// removeReaction drops a redacted reaction from whichever vote holds it.
+func (p *pollRecord) removeReaction(evtID id.EventID) bool {
+	for user, v := range p.Votes {
+		i := slices.IndexFunc(v.Reactions, func(x reactionVote) bool { return x.EventID == evtID })
+		if i < 0 {
+			continue
+		}
+		if p.Closed {
+			// Votes are final once the poll closed.
+			return false
+		}
+		v.Reactions = slices.Delete(v.Reactions, i, i+1)
+		p.Votes[user] = p.reactionTally(v)
+		return true
+	}
+	return false
+}
+
+// reactionTally derives the counted answers from the most recent distinct
+// reactions of a vote.
+func (p *pollRecord) reactionTally(v vote) vote {
+	v.Answers = nil
+	for _, rv := range slices.Backward(v.Reactions) {
+		if len(v.Answers) >= max(p.MaxSelections, 1) {
+			break
+		}
+		if !slices.Contains(v.Answers, rv.Answer) {
+			v.Answers = append(v.Answers, rv.Answer)
+		}
+	}
+	if n := len(v.Reactions); n > 0 {
+		v.Timestamp = v.Reactions[n-1].Timestamp
+	}
+	return v
+}
+
+// HandleReaction counts keycap reactions on reaction polls.
+func (c *PollCmd) HandleReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	rel := evt.Content.AsReaction().RelatesTo
+	idx := keycapIndex(rel.Key)
+	if idx < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, err := c.loadByEvent(rel.EventID)
+	if err != nil {
+		log.Printf("poll: error loading poll for %s: %v", rel.EventID, err)
+		return
+	}
+	if p == nil || !p.Reactions || p.RoomID != evt.RoomID || idx >= len(p.Answers) {
+		return
+	}
+	rv := reactionVote{EventID: evt.ID, Answer: p.Answers[idx].ID, Timestamp: evt.Timestamp}
+	if !p.recordReaction(evt.Sender, rv) {
+		return
+	}
+	if err := c.save(p); err != nil {
+		log.Printf("poll: error saving vote: %v", err)
+	}
+	if err := c.store.PutString(reactionKey(evt.ID), strconv.FormatInt(p.ID, 10)); err != nil {
+		log.Printf("poll: error indexing reaction: %v", err)
+	}
+}
+
+// HandleBacklogReaction counts votes cast while the bot was down. Recording
+// a reaction again is harmless.
+func (c *PollCmd) HandleBacklogReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	c.HandleReaction(ctx, cli, evt)
+}
+
+// HandleRedaction withdraws a vote when its keycap reaction is removed.
+func (c *PollCmd) HandleRedaction(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	redacts := evt.Redacts
+	if redacts == "" {
+		redacts = evt.Content.AsRedaction().Redacts
+	}
+	if redacts == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.store.GetString(reactionKey(redacts))
+	if err != nil || s == "" {
+		return
+	}
+	if err := c.store.Delete(reactionKey(redacts)); err != nil {
+		log.Printf("poll: error deleting reaction index: %v", err)
+	}
+	pid, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return
+	}
+	p, err := c.load(pid)
+	if err != nil || p == nil {
+		return
+	}
+	if p.removeReaction(redacts) {
+		if err := c.save(p); err != nil {
+			log.Printf("poll: error saving vote: %v", err)
+		}
+	}
+}
+
+func (c *PollCmd) roomMode(roomID id.RoomID) string {
+	m, err := c.store.GetString(modeKey(roomID))
+	if err != nil {
+		log.Printf("poll: error loading room mode: %v", err)
+	}
+	if m == "" {
+		return modeNative
+	}
+	return m
+}
+
+func (c *PollCmd) mode(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) == 0 {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Polls in this room use %s mode.", c.roomMode(evt.RoomID)))
+		return
+	}
+	m := strings.ToLower(args[0])
+	if m != modeNative && m != modeReactions {
+		command.ReplyUsage(ctx, cli, evt, "!poll mode [native|reactions]")
+		return
+	}
+	if !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, "Only room moderators can change the poll mode.")
+		return
+	}
+	if err := c.store.PutString(modeKey(evt.RoomID), m); err != nil {
+		log.Printf("poll: error saving room mode: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Polls in this room now use %s mode.", m))
+}
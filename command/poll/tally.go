@@ -0,0 +1,165 @@
+package poll
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+type answer struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type vote struct {
+	Answers   []string `json:"answers"`
+	Timestamp int64    `json:"ts"`
+	// Reactions holds the live keycap reactions behind a reaction poll vote.
+	Reactions []reactionVote `json:"reactions,omitempty"`
+}
+
+// pollRecord is the persisted state of a poll the bot started.
+type pollRecord struct {
+	ID            int64              `json:"id"`
+	EventID       id.EventID         `json:"event_id"`
+	RoomID        id.RoomID          `json:"room_id"`
+	Creator       id.UserID          `json:"creator"`
+	Question      string             `json:"question"`
+	Answers       []answer           `json:"answers"`
+	MaxSelections int                `json:"max_selections"`
+	Secret        bool               `json:"secret,omitempty"`
+	Reactions     bool               `json:"reactions,omitempty"`
+	ClosesAt      time.Time          `json:"closes_at,omitzero"`
+	Votes         map[id.UserID]vote `json:"votes"`
+	Closed        bool               `json:"closed"`
+	ClosedAt      int64              `json:"closed_at,omitempty"`
+}
+
+func pollKey(pid int64) string          { return "poll:" + strconv.FormatInt(pid, 10) }
+func eventKey(evtID id.EventID) string  { return "event:" + evtID.String() }
+func latestKey(roomID id.RoomID) string { return "latest:" + roomID.String() }
+
+// record applies a poll response. Per MSC3381 only a user's most recent
+// response counts, and responses sent after the poll closed are ignored.
+func (p *pollRecord) record(user id.UserID, answers []string, ts int64) bool {
+	if p.Closed && ts > p.ClosedAt {
+		return false
+	}
+	if prev, ok := p.Votes[user]; ok && prev.Timestamp > ts {
+		return false
+	}
+	if p.Votes == nil {
+		p.Votes = make(map[id.UserID]vote)
+	}
+	p.Votes[user] = vote{Answers: answers, Timestamp: ts}
+	return true
+}
+
+// valid returns the answers of v that count, or nil for a spoiled vote: one
+// that is empty or names an unknown answer. Extra selections beyond
+// MaxSelections are dropped.
+func (p *pollRecord) valid(v vote) []string {
+	var out []string
+	for _, a := range v.Answers {
+		if !slices.ContainsFunc(p.Answers, func(x answer) bool { return x.ID == a }) {
+			return nil
+		}
+		if !slices.Contains(out, a) {
+			out = append(out, a)
+		}
+	}
+	if p.MaxSelections > 0 && len(out) > p.MaxSelections {
+		out = out[:p.MaxSelections]
+	}
+	return out
+}
+
+// tally counts votes per answer ID and returns the number of voters whose
+// vote counted.
+func (p *pollRecord) tally() (map[string]int, int) {
+	counts := make(map[string]int, len(p.Answers))
+	for _, a := range p.Answers {
+		counts[a.ID] = 0
+	}
+	voters := 0
+	for _, v := range p.Votes {
+		sel := p.valid(v)
+		if len(sel) == 0 {
+			continue
+		}
+		voters++
+		for _, a := range sel {
+			counts[a]++
+		}
+	}
+	return counts, voters
+}
+
+func (p *pollRecord) status() string {
+	if p.Closed {
+		return "closed"
+	}
+	return "open"
+}
+
+// results renders the tally. Secret polls only reveal how many people voted
+// until they close.
+func (p *pollRecord) results() *matrixutil.Message {
+	counts, voters := p.tally()
+
+	msg := matrixutil.NewMessage().Text("📊 ").Bold(fmt.Sprintf("Poll #%d", p.ID)).Text(": " + p.Question)
+	if p.Secret && !p.Closed {
+		return msg.Textf(" (open, %d voters) — results are hidden until the poll closes", voters)
+	}
+
+	msg.Textf(" (%s, %d voters)", p.status(), voters)
+	items := make([]*matrixutil.Message, len(p.Answers))
+	for i, a := range p.Answers {
+		n := counts[a.ID]
+		pct := 0.0
+		if voters > 0 {
+			pct = float64(n) / float64(voters) * 100
+		}
+		items[i] = matrixutil.NewMessage().Text(a.Text+" — ").Bold(strconv.Itoa(n)).Textf(" (%.0f%%)", pct)
+	}
+	return msg.OrderedList(items...)
+}
+
+// endContent builds the poll.end event that closes p, carrying the final
+// counts both as a text fallback and as per-answer results.
+func (p *pollRecord) endContent() map[string]any {
+	counts, voters := p.tally()
+
+	top := 0
+	for _, n := range counts {
+		top = max(top, n)
+	}
+	var winners []string
+	for _, a := range p.Answers {
+		if top > 0 && counts[a.ID] == top {
+			winners = append(winners, a.Text)
+		}
+	}
+	text := fmt.Sprintf("The poll has ended with %d voters.", voters)
+	if len(winners) > 0 {
+		text = fmt.Sprintf("The poll has ended. Top answer: %s (%d votes, %d voters)", strings.Join(winners, ", "), top, voters)
+	}
+
+	return map[string]any{
+		"m.relates_to": map[string]any{
+			"rel_type": event.RelReference,
+			"event_id": p.EventID,
+		},
+		"org.matrix.msc3381.poll.end": map[string]any{},
+		"org.matrix.msc1767.text":     text,
+		"body":                        text,
+		"m.poll.results":              counts,
+	}
+}
@@ -0,0 +1,100 @@
+package quote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// APISink talks to a JSON quotes API:
+//
+//	POST /quotes                  Quote in, Quote with id and url out
+//	GET  /quotes/random?room=     one Quote
+//	GET  /quotes/{id}?room=       one Quote, 404 when missing
+//	GET  /quotes?room=&q=&limit=  array of Quote
+//
+// Token, when set, is sent as a bearer token.
+type APISink struct {
+	BaseURL string
+	Token   string
+}
+
+func (a *APISink) Post(ctx context.Context, q *Quote) error {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	var out Quote
+	if err := a.do(ctx, http.MethodPost, "/quotes", nil, body, &out); err != nil {
+		return fmt.Errorf("failed to post quote: %w", err)
+	}
+	q.ID, q.URL = out.ID, out.URL
+	return nil
+}
+
+func (a *APISink) Random(ctx context.Context, roomID id.RoomID) (*Quote, error) {
+	q := &Quote{}
+	err := a.do(ctx, http.MethodGet, "/quotes/random", url.Values{"room": {roomID.String()}}, nil, q)
+	return q, err
+}
+
+func (a *APISink) Get(ctx context.Context, roomID id.RoomID, quoteID string) (*Quote, error) {
+	q := &Quote{}
+	err := a.do(ctx, http.MethodGet, "/quotes/"+url.PathEscape(quoteID), url.Values{"room": {roomID.String()}}, nil, q)
+	return q, err
+}
+
+func (a *APISink) Search(ctx context.Context, roomID id.RoomID, text string, limit int) ([]*Quote, error) {
+	var qs []*Quote
+	params := url.Values{
+		"room":  {roomID.String()},
+		"q":     {text},
+		"limit": {strconv.Itoa(limit)},
+	}
+	err := a.do(ctx, http.MethodGet, "/quotes", params, nil, &qs)
+	return qs, err
+}
+
+func (a *APISink) do(ctx context.Context, method, path string, params url.Values, body []byte, dest any) error {
+	u := strings.TrimSuffix(a.BaseURL, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("quotes API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package quote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+)
+
+const (
+	// confirmTimeout is how long a quote preview waits for an answer.
+	confirmTimeout = 2 * time.Minute
+
+	reactYes = "✅"
+	reactNo  = "❌"
+)
+
+// pendingQuote is a selected quote waiting for its requester to confirm it.
+type pendingQuote struct {
+	quote     *Quote
+	lines     int
+	requester id.UserID
+	request   *event.Event // the command that selected it; the outcome replies to it
+	preview   id.EventID
+	timer     *time.Timer
+}
+
+// confirm shows the selected lines back to the requester, who posts them with
+// ✅ or "!quote yes" and discards them with ❌ or "!quote no". A newer
+// selection replaces the requester's previous one.
+func (q *QuoteCmd) confirm(ctx context.Context, cli *mautrix.Client, evt *event.Event, quote *Quote, lines int) {
+	preview := command.Prefixed(ctx, fmt.Sprintf("Quote these %d lines? React %s to post or %s to discard (or !quote yes / !quote no).", lines, reactYes, reactNo)) + "\n" + quote.Text
+	if quote.Comment != "" {
+		preview += "\n— " + quote.Comment
+	}
+	resp, err := command.Reply(ctx, cli, evt, preview)
+	if err != nil {
+		log.Printf("quote: failed to send preview: %v", err)
+		return
+	}
+
+	p := &pendingQuote{quote: quote, lines: lines, requester: evt.Sender, request: evt, preview: resp.EventID}
+	q.mu.Lock()
+	if old := q.pendingFor(evt.RoomID, evt.Sender); old != nil {
+		q.drop(old)
+	}
+	q.pending[p.preview] = p
+	p.timer = time.AfterFunc(confirmTimeout, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.pending[p.preview] == p {
+			delete(q.pending, p.preview)
+		}
+	})
+	q.mu.Unlock()
+
+	for _, key := range []string{reactYes, reactNo} {
+		if _, err := cli.SendReaction(ctx, evt.RoomID, resp.EventID, key); err != nil {
+			log.Printf("quote: failed to seed reaction %s: %v", key, err)
+		}
+	}
+}
+
+// answer resolves the sender's pending quote in the room.
+func (q *QuoteCmd) answer(yes bool) command.Handler {
+	return func(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+		q.resolvePending(ctx, cli, evt, yes)
+	}
+}
+
+func (q *QuoteCmd) resolvePending(ctx context.Context, cli *mautrix.Client, evt *event.Event, yes bool) {
+	q.mu.Lock()
+	p := q.pendingFor(evt.RoomID, evt.Sender)
+	if p != nil {
+		q.drop(p)
+	}
+	q.mu.Unlock()
+	if p == nil {
+		command.Reply(ctx, cli, evt, "You have no quote waiting for confirmation.")
+		return
+	}
+	q.resolve(ctx, cli, p, yes)
+}
+
+// HandleReaction resolves a pending quote when its requester reacts to the
+// preview.
+func (q *QuoteCmd) HandleReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	rel := evt.Content.AsReaction().RelatesTo
+	key := strings.TrimSuffix(rel.Key, "\ufe0f")
+	if key != reactYes && key != reactNo {
+		return
+	}
+
+	q.mu.Lock()
+	p, ok := q.pending[rel.EventID]
+	if !ok || p.requester != evt.Sender || p.quote.RoomID != evt.RoomID {
+		q.mu.Unlock()
+		return
+	}
+	q.drop(p)
+	q.mu.Unlock()
+	q.resolve(ctx, cli, p, key == reactYes)
+}
+
+func (q *QuoteCmd) resolve(ctx context.Context, cli *mautrix.Client, p *pendingQuote, yes bool) {
+	if !yes {
+		command.Reply(ctx, cli, p.request, "Quote discarded.")
+		return
+	}
+	q.post(ctx, cli, p)
+}
+
+// pendingFor finds the user's pending quote in the room. Callers hold q.mu.
+func (q *QuoteCmd) pendingFor(roomID id.RoomID, user id.UserID) *pendingQuote {
+	for _, p := range q.pending {
+		if p.quote.RoomID == roomID && p.requester == user {
+			return p
+		}
+	}
+	return nil
+}
+
+// drop forgets p. Callers hold q.mu.
+func (q *QuoteCmd) drop(p *pendingQuote) {
+	p.timer.Stop()
+	delete(q.pending, p.preview)
+}
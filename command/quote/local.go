@@ -0,0 +1,91 @@
+package quote
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/state"
+)
+
+const localKeyPrefix = "quote:"
+
+// LocalStore keeps quotes in the bot's own database.
+type LocalStore struct {
+	store *state.Namespace
+}
+
+func NewLocalStore(store *state.Namespace) *LocalStore {
+	return &LocalStore{store: store}
+}
+
+func (l *LocalStore) Post(ctx context.Context, q *Quote) error {
+	seq, err := l.store.NextSequence()
+	if err != nil {
+		return err
+	}
+	q.ID = strconv.FormatUint(seq, 10)
+	if q.Created.IsZero() {
+		q.Created = time.Now()
+	}
+	return l.store.PutJSON(localKeyPrefix+q.ID, q)
+}
+
+func (l *LocalStore) Random(ctx context.Context, roomID id.RoomID) (*Quote, error) {
+	qs, err := l.matching(roomID, func(*Quote) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if len(qs) == 0 {
+		return nil, ErrNotFound
+	}
+	return qs[rand.IntN(len(qs))], nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, roomID id.RoomID, quoteID string) (*Quote, error) {
+	q := &Quote{}
+	if err := l.store.GetJSON(localKeyPrefix+quoteID, q); err != nil {
+		return nil, err
+	}
+	if q.ID == "" || q.RoomID != roomID {
+		return nil, ErrNotFound
+	}
+	return q, nil
+}
+
+// Search returns the newest quotes containing text, ignoring case.
+func (l *LocalStore) Search(ctx context.Context, roomID id.RoomID, text string, limit int) ([]*Quote, error) {
+	text = strings.ToLower(text)
+	qs, err := l.matching(roomID, func(q *Quote) bool {
+		return strings.Contains(strings.ToLower(q.Text), text) || strings.Contains(strings.ToLower(q.Comment), text)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(qs, func(a, b *Quote) int { return b.Created.Compare(a.Created) })
+	if len(qs) > limit {
+		qs = qs[:limit]
+	}
+	return qs, nil
+}
+
+func (l *LocalStore) matching(roomID id.RoomID, keep func(*Quote) bool) ([]*Quote, error) {
+	var qs []*Quote
+	err := l.store.ForEach(localKeyPrefix, func(key string, value []byte) error {
+		q := &Quote{}
+		if err := json.Unmarshal(value, q); err != nil {
+			return nil
+		}
+		if q.RoomID == roomID && keep(q) {
+			qs = append(qs, q)
+		}
+		return nil
+	})
+	return qs, err
+}
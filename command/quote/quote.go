@@ -2,21 +2,30 @@ package quote
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"net/url"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 
+	"github.com/hionay/rubyChan/command"
 	"github.com/hionay/rubyChan/history"
 )
 
-const quoteWebsite = "https://quotes.halil.io"
+const (
+	searchLimit = 5
+	// historyWindow is how far back quote selections look.
+	historyWindow = 1000
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
 
 type HistoryFetcher interface {
 	GetLast(roomID id.RoomID, n int) []history.HistoryMessage
@@ -24,44 +33,89 @@ type HistoryFetcher interface {
 
 type QuoteCmd struct {
 	History HistoryFetcher
+	Sink    Sink
+
+	mu      sync.Mutex
+	pending map[id.EventID]*pendingQuote
+}
+
+func NewQuoteCmd(hist HistoryFetcher, sink Sink) *QuoteCmd {
+	return &QuoteCmd{
+		History: hist,
+		Sink:    sink,
+		pending: make(map[id.EventID]*pendingQuote),
+	}
 }
 
 func (*QuoteCmd) Name() string      { return "quote" }
 func (*QuoteCmd) Aliases() []string { return []string{"q"} }
-func (*QuoteCmd) Usage() string {
-	return "!quote <n> [comment] - Quote the last n messages with optional comment"
+func (q *QuoteCmd) Usage() string   { return q.Router().Usage() }
+
+func (*QuoteCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryFun, Summary: "Quote messages from this room", Examples: []string{"!quote 3 what a conversation", "!quote @alice:example.org 2", "!quote /deploy/", "!quote random"}}
+}
+
+func (q *QuoteCmd) Router() *command.Router {
+	return &command.Router{
+		Command: "quote",
+		Default: q.take,
+		DefaultUsage: "!quote <n> [comment] - Quote the last n messages with optional comment\n" +
+			"!quote @user [n] [comment] - Quote someone's last n messages\n" +
+			"!quote /regex/ [comment] - Quote the most recent message matching regex\n" +
+			"Reply to a message with !quote [n] to quote it, or it and the n-1 before it",
+		FreeArgs: true,
+		Subcommands: []command.Subcommand{
+			{Name: "yes", Usage: "!quote yes - Post the quote waiting for your confirmation", Handler: q.answer(true), MaxArgs: command.NoArgs},
+			{Name: "no", Usage: "!quote no - Discard the quote waiting for your confirmation", Handler: q.answer(false), MaxArgs: command.NoArgs},
+			{Name: "random", Usage: "!quote random - Show a random quote from this room", Handler: q.browse("random"), MaxArgs: command.NoArgs},
+			{Name: "get", Usage: "!quote get <id> - Show a quote", Handler: q.browse("get"), MaxArgs: 1},
+			{Name: "search", Usage: "!quote search <text> - Find quotes containing text", Handler: q.browse("search")},
+		},
+	}
 }
 
 func (q *QuoteCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	if len(args) < 1 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+q.Usage())
+	q.Router().Route(ctx, cli, evt, args)
+}
+
+// take selects history lines and asks for confirmation before quoting them.
+func (q *QuoteCmd) take(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	replyTo := evt.Content.AsMessage().RelatesTo.GetNonFallbackReplyTo()
+	sel, err := parseSelection(args, replyTo)
+	if errors.Is(err, errNoSelection) {
+		command.ReplyUsage(ctx, cli, evt, q.Usage())
 		return
 	}
-	n, err := strconv.Atoi(args[0])
-	if err != nil || n < 1 {
-		cli.SendText(ctx, evt.RoomID, "Invalid number of lines")
+	if err != nil {
+		command.Reply(ctx, cli, evt, err.Error())
 		return
 	}
-	comment := ""
-	if len(args) > 1 {
-		comment = strings.Join(args[1:], " ")
-	}
 
-	hist := q.History.GetLast(evt.RoomID, n+1)
-	if len(hist) <= 1 {
-		cli.SendText(ctx, evt.RoomID, "No messages to quote.")
+	hist := slices.DeleteFunc(q.History.GetLast(evt.RoomID, historyWindow), func(m history.HistoryMessage) bool {
+		return m.EventID == evt.ID
+	})
+	picked, err := sel.pick(hist)
+	if err != nil {
+		command.Reply(ctx, cli, evt, err.Error())
 		return
 	}
-	hist = hist[:len(hist)-1]
 
-	if n > len(hist) {
-		n = len(hist)
+	quote := &Quote{
+		Text:    formatLines(picked),
+		Comment: sel.comment,
+		RoomID:  evt.RoomID,
+		AddedBy: evt.Sender,
+		Created: time.Now(),
 	}
-	slice := hist[len(hist)-n:]
+	q.confirm(ctx, cli, evt, quote, len(picked))
+}
 
-	lines := make([]string, len(slice))
-	for i, m := range slice {
-		body := m.Body
+// formatLines renders history lines as "<nick> text", replacing MXIDs with
+// their localpart.
+func formatLines(msgs []history.HistoryMessage) string {
+	lines := make([]string, len(msgs))
+	for i, m := range msgs {
+		body := m.Text()
 		parts := strings.Fields(body)
 		for j, p := range parts {
 			sigil, localPart, _ := id.ParseCommonIdentifier(p)
@@ -74,46 +128,92 @@ func (q *QuoteCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.
 		}
 		lines[i] = fmt.Sprintf("<%s> %s", m.Sender, strings.Join(parts, " "))
 	}
-	quoteText := strings.Join(lines, "\n")
-	fullLink, err := postQuote(quoteText, comment)
-	if err != nil {
-		cli.SendText(ctx, evt.RoomID, "Failed to post quote: "+err.Error())
+	return strings.Join(lines, "\n")
+}
+
+func (q *QuoteCmd) post(ctx context.Context, cli *mautrix.Client, p *pendingQuote) {
+	if err := q.Sink.Post(ctx, p.quote); err != nil {
+		command.Reply(ctx, cli, p.request, "Failed to post quote: "+err.Error())
 		return
 	}
-	reply := fmt.Sprintf("Quoted %d messages: %s", n, fullLink)
-	cli.SendText(ctx, evt.RoomID, reply)
+	reply := fmt.Sprintf("Quoted %d messages", p.lines)
+	if p.quote.ID != "" {
+		reply += fmt.Sprintf(" as #%s", p.quote.ID)
+	}
+	if p.quote.URL != "" {
+		reply += ": " + p.quote.URL
+	}
+	command.Reply(ctx, cli, p.request, reply)
 }
 
-func postQuote(quoteText, comment string) (string, error) {
-	resp, err := http.PostForm(quoteWebsite+"/add", url.Values{
-		"quote":   {quoteText},
-		"comment": {comment},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to post quote: %w", err)
+func (q *QuoteCmd) browse(sub string) command.Handler {
+	return func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+		q.lookup(ctx, cli, evt, sub, args)
 	}
-	defer resp.Body.Close()
+}
 
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-	html := string(b)
-	marker := `class="text-[#b4a6c6] text-sm hover:underline"`
-	before, _, ok := strings.Cut(html, marker)
+func (q *QuoteCmd) lookup(ctx context.Context, cli *mautrix.Client, evt *event.Event, sub string, args []string) {
+	lib, ok := q.Sink.(Library)
 	if !ok {
-		return "", fmt.Errorf("failed to find quote link in response")
+		command.Reply(ctx, cli, evt, "The quote backend doesn't support browsing quotes.")
+		return
+	}
+
+	var (
+		quotes []*Quote
+		err    error
+	)
+	switch sub {
+	case "random":
+		var qt *Quote
+		if qt, err = lib.Random(ctx, evt.RoomID); err == nil {
+			quotes = []*Quote{qt}
+		}
+	case "get":
+		if len(args) != 1 {
+			command.ReplyUsage(ctx, cli, evt, "!quote get <id>")
+			return
+		}
+		var qt *Quote
+		if qt, err = lib.Get(ctx, evt.RoomID, strings.TrimPrefix(args[0], "#")); err == nil {
+			quotes = []*Quote{qt}
+		}
+	case "search":
+		if len(args) == 0 {
+			command.ReplyUsage(ctx, cli, evt, "!quote search <text>")
+			return
+		}
+		quotes, err = lib.Search(ctx, evt.RoomID, strings.Join(args, " "), searchLimit)
+	}
+	switch {
+	case errors.Is(err, ErrNotFound) || (err == nil && len(quotes) == 0):
+		command.Reply(ctx, cli, evt, "No quotes found.")
+		return
+	case err != nil:
+		log.Printf("quote: %s error: %v", sub, err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+
+	blocks := make([]string, len(quotes))
+	for i, qt := range quotes {
+		blocks[i] = formatQuote(qt)
+	}
+	command.Reply(ctx, cli, evt, strings.Join(blocks, "\n\n"))
+}
+
+func formatQuote(q *Quote) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Quote #%s", q.ID)
+	if !q.Created.IsZero() {
+		fmt.Fprintf(&b, " (%s)", q.Created.Format(time.DateOnly))
 	}
-	hrefIdx := strings.LastIndex(before, `<a href="`)
-	if hrefIdx < 0 {
-		return "", fmt.Errorf("failed to find quote link in response")
+	if q.Comment != "" {
+		fmt.Fprintf(&b, " — %s", q.Comment)
 	}
-	start := hrefIdx + len(`<a href="`)
-	end := strings.Index(html[start:], `"`)
-	if end < 0 {
-		return "", fmt.Errorf("failed to find quote link in response")
+	b.WriteString("\n" + q.Text)
+	if q.URL != "" {
+		b.WriteString("\n" + q.URL)
 	}
-	linkPath := html[start : start+end]
-	fullLink := quoteWebsite + linkPath
-	return fullLink, nil
+	return b.String()
 }
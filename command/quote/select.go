@@ -0,0 +1,156 @@
+package quote
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/history"
+)
+
+// maxLines caps how many lines a single quote may take.
+const maxLines = 50
+
+var errNoSelection = errors.New("nothing selected")
+
+// selection describes which history lines a !quote takes:
+//
+//	!quote 3              the last three lines
+//	!quote @alice 4       alice's last four lines
+//	!quote /regex/        the most recent line matching regex
+//	(as a reply) !quote   the replied-to line; with a count or sender, lines
+//	                      up to and including it
+//
+// Anything after the selection is the quote's comment.
+type selection struct {
+	replyTo id.EventID
+	count   int
+	sender  string
+	pattern *regexp.Regexp
+	comment string
+}
+
+func parseSelection(args []string, replyTo id.EventID) (selection, error) {
+	sel := selection{replyTo: replyTo, count: 1}
+	if len(args) == 0 {
+		if replyTo == "" {
+			return sel, errNoSelection
+		}
+		return sel, nil
+	}
+
+	switch first := args[0]; {
+	case strings.HasPrefix(first, "/"):
+		raw := strings.Join(args, " ")
+		end := closingSlash(raw)
+		if end < 0 {
+			return sel, fmt.Errorf("Missing closing / in pattern")
+		}
+		re, err := regexp.Compile(raw[1:end])
+		if err != nil {
+			return sel, fmt.Errorf("Invalid pattern: %v", err)
+		}
+		sel.pattern = re
+		sel.comment = strings.TrimSpace(raw[end+1:])
+		return sel, nil
+	case strings.HasPrefix(first, "@"):
+		if strings.Contains(first, ":") {
+			if _, err := command.ParseUserID(first); err != nil {
+				return sel, fmt.Errorf("Invalid user: %v", err)
+			}
+		}
+		sel.sender = first
+		args = args[1:]
+		if len(args) > 0 {
+			if n, err := command.ParseInt(args[0]); err == nil {
+				sel.count = n
+				args = args[1:]
+			}
+		}
+	default:
+		n, err := command.ParseInt(first)
+		switch {
+		case err == nil:
+			sel.count = n
+			args = args[1:]
+		case replyTo == "":
+			return sel, errNoSelection
+		}
+	}
+	if sel.count < 1 || sel.count > maxLines {
+		return sel, fmt.Errorf("Invalid number of lines (1-%d)", maxLines)
+	}
+	sel.comment = strings.Join(args, " ")
+	return sel, nil
+}
+
+// closingSlash returns the index of the first unescaped "/" after the
+// opening one, or -1.
+func closingSlash(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			return i
+		}
+	}
+	return -1
+}
+
+// pick applies the selection to hist, which is in chronological order.
+func (sel selection) pick(hist []history.HistoryMessage) ([]history.HistoryMessage, error) {
+	if sel.replyTo != "" {
+		i := -1
+		for j, m := range hist {
+			if m.EventID == sel.replyTo {
+				i = j
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("I can't find that message in my history.")
+		}
+		hist = hist[:i+1]
+	}
+
+	if sel.pattern != nil {
+		for i := len(hist) - 1; i >= 0; i-- {
+			if sel.pattern.MatchString(hist[i].Text()) {
+				return hist[i : i+1], nil
+			}
+		}
+		return nil, fmt.Errorf("No message matches that pattern.")
+	}
+
+	if sel.sender != "" {
+		var own []history.HistoryMessage
+		for _, m := range hist {
+			if sel.sentBy(m) {
+				own = append(own, m)
+			}
+		}
+		if len(own) == 0 {
+			return nil, fmt.Errorf("No messages from %s to quote.", sel.sender)
+		}
+		hist = own
+	}
+
+	if len(hist) == 0 {
+		return nil, fmt.Errorf("No messages to quote.")
+	}
+	n := min(sel.count, len(hist))
+	return hist[len(hist)-n:], nil
+}
+
+// sentBy matches a full MXID against the sender, or a bare @nick against the
+// sender's localpart.
+func (sel selection) sentBy(m history.HistoryMessage) bool {
+	if strings.Contains(sel.sender, ":") {
+		return m.SenderID == id.UserID(sel.sender)
+	}
+	return strings.EqualFold(m.Sender, strings.TrimPrefix(sel.sender, "@"))
+}
@@ -0,0 +1,37 @@
+package quote
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// ErrNotFound is returned by a Library when no quote matches.
+var ErrNotFound = errors.New("quote not found")
+
+type Quote struct {
+	ID      string    `json:"id"`
+	Text    string    `json:"quote"`
+	Comment string    `json:"comment,omitempty"`
+	RoomID  id.RoomID `json:"room_id,omitempty"`
+	AddedBy id.UserID `json:"added_by,omitempty"`
+	Created time.Time `json:"created,omitzero"`
+	URL     string    `json:"url,omitempty"`
+}
+
+// Sink is where posted quotes go. Post fills in the ID and URL the backend
+// assigned, whichever it knows.
+type Sink interface {
+	Post(ctx context.Context, q *Quote) error
+}
+
+// Library is a Sink whose quotes can be browsed from chat. Lookups are scoped
+// to the room the quote was taken in.
+type Library interface {
+	Sink
+	Random(ctx context.Context, roomID id.RoomID) (*Quote, error)
+	Get(ctx context.Context, roomID id.RoomID, quoteID string) (*Quote, error)
+	Search(ctx context.Context, roomID id.RoomID, text string, limit int) ([]*Quote, error)
+}
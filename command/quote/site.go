@@ -0,0 +1,65 @@
+package quote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const quoteWebsite = "https://quotes.halil.io"
+
+// SiteSink posts quotes through the web form of a quotes site and scrapes the
+// link to the new quote out of the returned page.
+type SiteSink struct {
+	BaseURL string
+}
+
+func (s *SiteSink) baseURL() string {
+	if s.BaseURL == "" {
+		return quoteWebsite
+	}
+	return strings.TrimSuffix(s.BaseURL, "/")
+}
+
+func (s *SiteSink) Post(ctx context.Context, q *Quote) error {
+	form := url.Values{
+		"quote":   {q.Text},
+		"comment": {q.Comment},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL()+"/add", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post quote: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	html := string(b)
+	marker := `class="text-[#b4a6c6] text-sm hover:underline"`
+	before, _, ok := strings.Cut(html, marker)
+	if !ok {
+		return fmt.Errorf("failed to find quote link in response")
+	}
+	hrefIdx := strings.LastIndex(before, `<a href="`)
+	if hrefIdx < 0 {
+		return fmt.Errorf("failed to find quote link in response")
+	}
+	start := hrefIdx + len(`<a href="`)
+	end := strings.Index(html[start:], `"`)
+	if end < 0 {
+		return fmt.Errorf("failed to find quote link in response")
+	}
+	linkPath := html[start : start+end]
+	q.URL = s.baseURL() + linkPath
+	return nil
+}
@@ -0,0 +1,245 @@
+package command
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// Rate is a token bucket: Burst tokens, refilled one every Every. The zero
+// value is unlimited.
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+func (r Rate) unlimited() bool {
+	return r.Burst <= 0 || r.Every <= 0
+}
+
+// ParseRate parses "N/duration", e.g. "100/24h" for 100 tokens a day.
+func ParseRate(s string) (Rate, error) {
+	n, per, ok := strings.Cut(s, "/")
+	burst, err := strconv.Atoi(n)
+	if !ok || err != nil || burst < 1 {
+		return Rate{}, fmt.Errorf("invalid rate %q (use N/duration, e.g. 100/24h)", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q (use N/duration, e.g. 100/24h)", s)
+	}
+	return Rate{Burst: burst, Every: d / time.Duration(burst)}, nil
+}
+
+// Limits throttles a command. Zero fields fall back to the limiter's
+// defaults.
+type Limits struct {
+	// Cooldown is the minimum time between two runs by the same user in a
+	// room.
+	Cooldown time.Duration
+	User     Rate
+	Room     Rate
+	// APICost is how many tokens a run draws from the global outbound API
+	// budget, for commands that call quota-limited services.
+	APICost int
+	// CooldownKey names the cooldown the command shares with others, such as
+	// an alias with the command it runs. It defaults to the command's name.
+	CooldownKey string
+}
+
+// Limited is implemented by commands with their own limits.
+type Limited interface {
+	Limits() Limits
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// wait refills b at rate r and returns how long until it holds n tokens.
+func (b *bucket) wait(r Rate, n int, now time.Time) time.Duration {
+	b.tokens = math.Min(float64(r.Burst), b.tokens+float64(now.Sub(b.last))/float64(r.Every))
+	b.last = now
+	if missing := float64(n) - b.tokens; missing > 0 {
+		return time.Duration(missing * float64(r.Every))
+	}
+	return 0
+}
+
+// Limiter enforces command limits in the dispatch path: per-command cooldowns,
+// token buckets per user and per room, and a global budget shared by every
+// command that calls an outside API.
+type Limiter struct {
+	defaults Limits
+	api      Rate
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	lastRun  map[string]time.Time
+	notified map[string]time.Time
+}
+
+func NewLimiter(defaults Limits, api Rate) *Limiter {
+	return &Limiter{
+		defaults: defaults,
+		api:      api,
+		buckets:  make(map[string]*bucket),
+		lastRun:  make(map[string]time.Time),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// maxEntries bounds the limiter's bookkeeping; past it, stale entries are
+// dropped.
+const maxEntries = 10000
+
+// Allow reports whether the user may run cmd in the room now, and records the
+// run if so. When not, it returns how long to wait and whether the user should
+// be told: only the first refusal of a throttling period gets a notice.
+func (l *Limiter) Allow(cmd Command, roomID id.RoomID, user id.UserID) (wait time.Duration, notify bool) {
+	lim := l.defaults
+	if c, ok := cmd.(Limited); ok {
+		own := c.Limits()
+		if own.Cooldown > 0 {
+			lim.Cooldown = own.Cooldown
+		}
+		if !own.User.unlimited() {
+			lim.User = own.User
+		}
+		if !own.Room.unlimited() {
+			lim.Room = own.Room
+		}
+		lim.APICost = own.APICost
+		lim.CooldownKey = own.CooldownKey
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	name := cmp.Or(lim.CooldownKey, cmd.Name())
+	runKey := name + "|" + roomID.String() + "|" + user.String()
+	checks := []check{
+		{"user|" + roomID.String() + "|" + user.String(), lim.User, 1},
+		{"room|" + roomID.String(), lim.Room, 1},
+		{"api", l.api, lim.APICost},
+	}
+
+	if lim.Cooldown > 0 {
+		if last, ok := l.lastRun[runKey]; ok {
+			wait = max(wait, last.Add(lim.Cooldown).Sub(now))
+		}
+	}
+	wait = max(wait, l.wait(checks, now))
+
+	if wait > 0 {
+		noticeKey := roomID.String() + "|" + user.String()
+		if until, ok := l.notified[noticeKey]; ok && now.Before(until) {
+			return wait, false
+		}
+		l.notified[noticeKey] = now.Add(wait)
+		return wait, true
+	}
+
+	l.take(checks)
+	if lim.Cooldown > 0 {
+		l.lastRun[runKey] = now
+	}
+	return 0, false
+}
+
+// AllowSuggestion reports whether the user may be sent a "Did you mean"
+// reply to an unknown command now. It counts against the user's and the
+// room's default rates like a command run; refused suggestions are dropped
+// without a notice.
+func (l *Limiter) AllowSuggestion(roomID id.RoomID, user id.UserID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	checks := []check{
+		{"user|" + roomID.String() + "|" + user.String(), l.defaults.User, 1},
+		{"room|" + roomID.String(), l.defaults.Room, 1},
+	}
+	if l.wait(checks, now) > 0 {
+		return false
+	}
+	l.take(checks)
+	return true
+}
+
+// check is a draw of cost tokens from the bucket under key.
+type check struct {
+	key  string
+	rate Rate
+	cost int
+}
+
+// wait returns how long until all checks can be drawn.
+func (l *Limiter) wait(checks []check, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, c := range checks {
+		if c.rate.unlimited() || c.cost <= 0 {
+			continue
+		}
+		wait = max(wait, l.bucket(c.key, c.rate).wait(c.rate, c.cost, now))
+	}
+	return wait
+}
+
+// take draws checks that wait found available.
+func (l *Limiter) take(checks []check) {
+	for _, c := range checks {
+		if c.rate.unlimited() || c.cost <= 0 {
+			continue
+		}
+		l.buckets[c.key].tokens -= float64(c.cost)
+	}
+}
+
+func (l *Limiter) bucket(key string, r Rate) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(r.Burst), last: time.Now()}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep drops bookkeeping that no longer affects any decision once the maps
+// grow large. Buckets idle for an hour are assumed to have refilled.
+func (l *Limiter) sweep(now time.Time) {
+	if len(l.buckets)+len(l.lastRun)+len(l.notified) < maxEntries {
+		return
+	}
+	for k, b := range l.buckets {
+		if k != "api" && now.Sub(b.last) > time.Hour {
+			delete(l.buckets, k)
+		}
+	}
+	for k, t := range l.lastRun {
+		if now.Sub(t) > time.Hour {
+			delete(l.lastRun, k)
+		}
+	}
+	for k, t := range l.notified {
+		if now.After(t) {
+			delete(l.notified, k)
+		}
+	}
+}
+
+// SlowDown is the notice for a throttled user.
+func SlowDown(wait time.Duration) string {
+	wait = max(wait.Round(time.Second), time.Second)
+	return fmt.Sprintf("Slow down, try again in %s", wait)
+}
@@ -0,0 +1,302 @@
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/rubyChan/command"
+)
+
+// cronSchedule is a standard five-field cron expression: minute, hour, day of
+// month, month and day of week. Each field is kept as a bitset of the values
+// it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+	c := &cronSchedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// Both 0 and 7 mean Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "a", "a-b", each with
+// an optional "/step", into a bitset of values within [lo, hi].
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		start, end := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first matching minute strictly after t, in t's location.
+// It gives up after five years, returning the zero time.
+//
+// The search walks the wall clock rather than real time, so that a DST change
+// neither skips a day nor fires twice: see resolve.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	w := wallClock(t).Add(time.Minute)
+	end := w.AddDate(5, 0, 0)
+	for w.Before(end) {
+		switch {
+		case c.month&(1<<int(w.Month())) == 0:
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(w):
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<w.Hour()) == 0:
+			w = w.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<w.Minute()) == 0:
+			w = w.Add(time.Minute)
+		default:
+			// A repeated wall time resolves to its first occurrence, which
+			// is behind t when t is in the second one.
+			if at := resolve(w, loc); at.After(t) {
+				return at
+			}
+			w = w.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+// wallClock returns t's wall-clock time to the minute, as a time in UTC.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// resolve turns a wall-clock time from wallClock into an instant in loc. A
+// time repeated when the clocks go back resolves to its first occurrence; one
+// skipped when they go forward is moved on by the gap, so 02:30 on the night
+// clocks jump from 02:00 to 03:00 is 03:30. time.Date picks either way
+// depending on the zone.
+func resolve(w time.Time, loc *time.Location) time.Time {
+	// No zone changes its offset twice within two days.
+	_, before := w.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := w.Add(24 * time.Hour).In(loc).Zone()
+	var first time.Time
+	for _, off := range []int{before, after} {
+		at := w.Add(-time.Duration(off) * time.Second).In(loc)
+		if wallClock(at).Equal(w) && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+	if first.IsZero() {
+		return w.Add(-time.Duration(before) * time.Second).In(loc)
+	}
+	return first
+}
+
+// dayMatches follows cron's rule that a restricted day of month and day of
+// week match when either one does.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<t.Day()) != 0
+	dowOK := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// minInterval keeps "every" reminders from flooding a room.
+const minInterval = time.Minute
+
+const everyPrefix = "@every "
+
+// parseEvery resolves the schedule of an "every ..." reminder into a
+// canonical spec that nextOccurrence understands, and returns the remaining
+// arguments. Supported forms:
+//
+//	every 30m | every 2d
+//	every hour | every day [09:00] | every weekday [09:00] | every weekend [10:00]
+//	every friday [20:00]
+//	every 0 9 * * 1-5 (cron)
+func parseEvery(args []string) (string, []string, error) {
+	if len(args) < 2 {
+		return "", nil, errNoWhen
+	}
+	args = args[1:]
+
+	if len(args) >= 5 {
+		expr := strings.Join(args[:5], " ")
+		if _, err := parseCron(expr); err == nil {
+			return expr, args[5:], nil
+		}
+	}
+	if d, err := command.ParseDuration(args[0]); err == nil {
+		if d < minInterval {
+			return "", nil, fmt.Errorf("interval must be at least %s", minInterval)
+		}
+		return everyPrefix + d.String(), args[1:], nil
+	}
+
+	word := strings.ToLower(args[0])
+	if word == "hour" || word == "hourly" {
+		return "0 * * * *", args[1:], nil
+	}
+	var dow string
+	switch word {
+	case "day", "daily":
+		dow = "*"
+	case "weekday", "weekdays":
+		dow = "1-5"
+	case "weekend", "weekends":
+		dow = "0,6"
+	default:
+		wd, ok := weekdays[word]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown schedule %q (use an interval, day, weekday, a day name or a cron expression)", args[0])
+		}
+		dow = strconv.Itoa(int(wd))
+	}
+	h, m := defaultHour, 0
+	rest := args[1:]
+	if len(rest) > 0 {
+		if hh, mm, ok := parseClock(rest[0]); ok {
+			h, m, rest = hh, mm, rest[1:]
+		}
+	}
+	return fmt.Sprintf("%d %d * * %s", m, h, dow), rest, nil
+}
+
+// nextOccurrence returns the first firing of spec after t, evaluated in loc.
+func nextOccurrence(spec string, t time.Time, loc *time.Location) (time.Time, error) {
+	if ds, ok := strings.CutPrefix(spec, everyPrefix); ok {
+		d, err := time.ParseDuration(ds)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.Add(d), nil
+	}
+	c, err := parseCron(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := c.next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", spec)
+	}
+	return next, nil
+}
+
+// describeRepeat names a spec for people: "every 1h30m", "every weekday at
+// 09:00". Cron expressions that no shorthand of parseEvery produces are shown
+// as they are.
+func describeRepeat(spec string) string {
+	if ds, ok := strings.CutPrefix(spec, everyPrefix); ok {
+		d, err := time.ParseDuration(ds)
+		if err != nil {
+			return "every " + ds
+		}
+		return "every " + formatInterval(d)
+	}
+	if spec == "0 * * * *" {
+		return "every hour"
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 || fields[2] != "*" || fields[3] != "*" {
+		return fmt.Sprintf("cron %q", spec)
+	}
+	m, errM := strconv.Atoi(fields[0])
+	h, errH := strconv.Atoi(fields[1])
+	if errM != nil || errH != nil || m < 0 || m > 59 || h < 0 || h > 23 {
+		return fmt.Sprintf("cron %q", spec)
+	}
+	var days string
+	switch fields[4] {
+	case "*":
+		days = "day"
+	case "1-5":
+		days = "weekday"
+	case "0,6":
+		days = "weekend"
+	default:
+		wd, err := strconv.Atoi(fields[4])
+		if err != nil || wd < 0 || wd > 7 {
+			return fmt.Sprintf("cron %q", spec)
+		}
+		days = time.Weekday(wd % 7).String()
+	}
+	return fmt.Sprintf("every %s at %02d:%02d", days, h, m)
+}
+
+// formatInterval writes d the way it is typed: whole days as "2d", anything
+// else in hours and minutes without the zero units, "1h30m" for "1h30m0s".
+func formatInterval(d time.Duration) string {
+	var b strings.Builder
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	if h := d / time.Hour; h > 0 {
+		fmt.Fprintf(&b, "%dh", h)
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		fmt.Fprintf(&b, "%dm", m)
+		d -= m * time.Minute
+	}
+	if d > 0 || b.Len() == 0 {
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
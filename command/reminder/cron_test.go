@@ -0,0 +1,230 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 9 * * *", false},
+		{"*/15 * * * *", false},
+		{"0 9 * * 1-5", false},
+		{"30 8 1,15 * *", false},
+		{"0 0 * * 7", false},
+		{"0 12 31 1-12/2 *", false},
+		{"0 9 * *", true},
+		{"0 9 * * * *", true},
+		{"60 9 * * *", true},
+		{"0 24 * * *", true},
+		{"0 9 0 * *", true},
+		{"0 9 * 13 *", true},
+		{"0 9 * * 8", true},
+		{"0 9 * * 5-1", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		loc  *time.Location // want's location when nil
+		want time.Time
+	}{
+		{
+			name: "later today",
+			spec: "0 9 * * *",
+			from: time.Date(2025, 6, 10, 8, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 6, 10, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "strictly after",
+			spec: "0 9 * * *",
+			from: time.Date(2025, 6, 10, 9, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 6, 11, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "weekday skips the weekend",
+			spec: "0 9 * * 1-5",
+			from: time.Date(2025, 6, 13, 10, 0, 0, 0, time.UTC), // Friday
+			want: time.Date(2025, 6, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "sunday as 7",
+			spec: "0 10 * * 7",
+			from: time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "day of month or day of week",
+			spec: "0 9 20 * 1",
+			from: time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC), // Tuesday
+			want: time.Date(2025, 6, 20, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "31st skips short months",
+			spec: "0 9 31 * *",
+			from: time.Date(2025, 3, 31, 10, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 5, 31, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "last of the year",
+			spec: "59 23 31 12 *",
+			from: time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC),
+			want: time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC),
+		},
+		{
+			name: "leap day",
+			spec: "0 9 29 2 *",
+			from: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2028, 2, 29, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "evaluated in the given zone",
+			spec: "0 9 * * *",
+			from: time.Date(2025, 6, 10, 14, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 6, 11, 9, 0, 0, 0, newYork),
+		},
+		{
+			name: "across spring forward",
+			spec: "0 9 * * *",
+			from: time.Date(2025, 3, 8, 9, 0, 0, 0, newYork),
+			want: time.Date(2025, 3, 9, 9, 0, 0, 0, newYork),
+		},
+		{
+			name: "skipped time moves on by the gap",
+			spec: "30 2 * * *",
+			from: time.Date(2025, 3, 8, 3, 0, 0, 0, newYork),
+			loc:  newYork,
+			want: time.Date(2025, 3, 9, 7, 30, 0, 0, time.UTC), // 03:30 EDT
+		},
+		{
+			name: "after the skipped time",
+			spec: "30 2 * * *",
+			from: time.Date(2025, 3, 9, 7, 30, 0, 0, time.UTC),
+			loc:  newYork,
+			want: time.Date(2025, 3, 10, 2, 30, 0, 0, newYork),
+		},
+		{
+			name: "skipped time in Europe",
+			spec: "30 2 * * *",
+			from: time.Date(2025, 3, 29, 12, 0, 0, 0, berlin),
+			loc:  berlin,
+			want: time.Date(2025, 3, 30, 1, 30, 0, 0, time.UTC), // 03:30 CEST
+		},
+		{
+			name: "repeated time fires first",
+			spec: "30 1 * * *",
+			from: time.Date(2025, 11, 2, 0, 0, 0, 0, newYork),
+			loc:  newYork,
+			want: time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+		},
+		{
+			name: "repeated time fires once",
+			spec: "30 1 * * *",
+			from: time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC),
+			loc:  newYork,
+			want: time.Date(2025, 11, 3, 1, 30, 0, 0, newYork),
+		},
+		{
+			name: "repeated time in Europe fires first",
+			spec: "30 2 * * *",
+			from: time.Date(2025, 10, 25, 12, 0, 0, 0, berlin),
+			loc:  berlin,
+			want: time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC), // 02:30 CEST
+		},
+		{
+			name: "hourly through fall back",
+			spec: "0 * * * *",
+			from: time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+			loc:  newYork,
+			want: time.Date(2025, 11, 2, 7, 0, 0, 0, time.UTC), // 02:00 EST
+		},
+		{
+			name: "interval",
+			spec: everyPrefix + "1h30m0s",
+			from: time.Date(2025, 6, 10, 8, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 6, 10, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "interval ignores the zone",
+			spec: everyPrefix + "24h0m0s",
+			from: time.Date(2025, 3, 8, 12, 0, 0, 0, newYork),
+			want: time.Date(2025, 3, 9, 13, 0, 0, 0, newYork),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = tt.want.Location()
+			}
+			got, err := nextOccurrence(tt.spec, tt.from, loc)
+			if err != nil {
+				t.Fatalf("nextOccurrence(%q, %v) error: %v", tt.spec, tt.from, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("nextOccurrence(%q, %v) = %v, want %v", tt.spec, tt.from, got, tt.want.In(got.Location()))
+			}
+		})
+	}
+}
+
+func TestNextOccurrenceNever(t *testing.T) {
+	if _, err := nextOccurrence("0 9 31 2 *", time.Now(), time.UTC); err == nil {
+		t.Error("nextOccurrence for February 31st: no error")
+	}
+	if _, err := nextOccurrence("0 9 * *", time.Now(), time.UTC); err == nil {
+		t.Error("nextOccurrence for an invalid expression: no error")
+	}
+}
+
+func TestDescribeRepeat(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{everyPrefix + "30m0s", "every 30m"},
+		{everyPrefix + "1h0m0s", "every 1h"},
+		{everyPrefix + "1h30m0s", "every 1h30m"},
+		{everyPrefix + "24h0m0s", "every 1d"},
+		{everyPrefix + "48h0m0s", "every 2d"},
+		{everyPrefix + "36h0m0s", "every 36h"},
+		{"0 * * * *", "every hour"},
+		{"0 9 * * *", "every day at 09:00"},
+		{"30 8 * * 1-5", "every weekday at 08:30"},
+		{"0 10 * * 0,6", "every weekend at 10:00"},
+		{"0 20 * * 5", "every Friday at 20:00"},
+		{"0 20 * * 7", "every Sunday at 20:00"},
+		{"*/15 9-17 * * 1-5", `cron "*/15 9-17 * * 1-5"`},
+		{"0 9 1 * *", `cron "0 9 1 * *"`},
+	}
+	for _, tt := range tests {
+		if got := describeRepeat(tt.spec); got != tt.want {
+			t.Errorf("describeRepeat(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
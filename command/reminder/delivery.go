@@ -0,0 +1,217 @@
+package reminder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/internal/matrixutil"
+)
+
+const (
+	deliveryKeyPrefix = "sent:"
+
+	// DefaultSnooze is how long a ⏰ or 🔁 reaction postpones a reminder.
+	DefaultSnooze = 10 * time.Minute
+	// followUpDelay is how long an unacknowledged reminder waits before its
+	// single follow-up ping.
+	followUpDelay = 15 * time.Minute
+	// deliveryTTL bounds how long reactions on a delivered reminder count. The
+	// delivery is forgotten once it passes.
+	deliveryTTL = 24 * time.Hour
+)
+
+const (
+	reactAck     = "✅"
+	reactSnooze  = "⏰"
+	reactSnooze2 = "🔁"
+)
+
+// delivery tracks a delivered reminder message so reactions on it, or on its
+// follow-up, can acknowledge or snooze it.
+type delivery struct {
+	EventID    id.EventID `json:"event_id"`
+	FollowUpID id.EventID `json:"follow_up_id,omitempty"`
+	Reminder   reminder   `json:"reminder"`
+	Sent       time.Time  `json:"sent"`
+
+	timer  *time.Timer // follow-up
+	expiry *time.Timer
+}
+
+// track starts listening for reactions on a delivered reminder and arms its
+// follow-up. Room-wide reminders get no follow-up, as nobody owns them.
+func (rc *RemindMeCmd) track(ctx context.Context, cli *mautrix.Client, r *reminder, eventID id.EventID) {
+	d := &delivery{EventID: eventID, Reminder: *r, Sent: time.Now()}
+	d.Reminder.timer = nil
+	if err := rc.store.PutJSON(deliveryKeyPrefix+eventID.String(), d); err != nil {
+		log.Printf("reminder: error saving delivery of #%d: %v", r.ID, err)
+	}
+	rc.mu.Lock()
+	rc.deliveries[eventID] = d
+	rc.armExpiryLocked(d)
+	rc.mu.Unlock()
+	rc.armFollowUp(ctx, cli, d)
+}
+
+// armExpiryLocked forgets d once deliveryTTL has passed. rc.mu must be held.
+func (rc *RemindMeCmd) armExpiryLocked(d *delivery) {
+	d.expiry = time.AfterFunc(time.Until(d.Sent.Add(deliveryTTL)), func() {
+		rc.untrack(d)
+	})
+}
+
+func (rc *RemindMeCmd) armFollowUp(ctx context.Context, cli *mautrix.Client, d *delivery) {
+	if d.Reminder.WholeRoom || d.FollowUpID != "" {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	d.timer = time.AfterFunc(time.Until(d.Sent.Add(followUpDelay)), func() {
+		rc.followUp(ctx, cli, d)
+	})
+}
+
+func (rc *RemindMeCmd) followUp(ctx context.Context, cli *mautrix.Client, d *delivery) {
+	rc.mu.Lock()
+	_, pending := rc.deliveries[d.EventID]
+	rc.mu.Unlock()
+	if !pending {
+		return
+	}
+
+	r := &d.Reminder
+	to := r.recipient()
+	msg := matrixutil.NewMessage().
+		Mention(to, matrixutil.DisplayNick(ctx, cli, r.RoomID, to.String())).
+		Textf(": reminder #%d is still waiting: %s — react %s to acknowledge or %s to snooze", r.ID, r.Message, reactAck, reactSnooze)
+	resp, err := cli.SendMessageEvent(ctx, r.RoomID, event.EventMessage, msg.Content())
+	if err != nil {
+		log.Printf("reminder: failed to follow up #%d: %v", r.ID, err)
+		return
+	}
+
+	rc.mu.Lock()
+	if _, pending := rc.deliveries[d.EventID]; !pending {
+		// Acknowledged or expired while the follow-up was on its way.
+		rc.mu.Unlock()
+		return
+	}
+	d.FollowUpID = resp.EventID
+	rc.deliveries[resp.EventID] = d
+	rc.mu.Unlock()
+	if err := rc.store.PutJSON(deliveryKeyPrefix+d.EventID.String(), d); err != nil {
+		log.Printf("reminder: error saving delivery of #%d: %v", r.ID, err)
+	}
+}
+
+// untrack stops listening for reactions on d and forgets it. It reports false
+// when another reaction, or the expiry, got there first.
+func (rc *RemindMeCmd) untrack(d *delivery) bool {
+	rc.mu.Lock()
+	if _, ok := rc.deliveries[d.EventID]; !ok {
+		rc.mu.Unlock()
+		return false
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	if d.expiry != nil {
+		d.expiry.Stop()
+	}
+	delete(rc.deliveries, d.EventID)
+	if d.FollowUpID != "" {
+		delete(rc.deliveries, d.FollowUpID)
+	}
+	rc.mu.Unlock()
+	if err := rc.store.Delete(deliveryKeyPrefix + d.EventID.String()); err != nil {
+		log.Printf("reminder: error deleting delivery of #%d: %v", d.Reminder.ID, err)
+	}
+	return true
+}
+
+// restoreDeliveries reloads tracked deliveries, dropping expired ones and
+// re-arming follow-ups that have not been sent yet.
+func (rc *RemindMeCmd) restoreDeliveries(ctx context.Context, cli *mautrix.Client) error {
+	var expired []string
+	err := rc.store.ForEach(deliveryKeyPrefix, func(key string, value []byte) error {
+		d := &delivery{}
+		if err := json.Unmarshal(value, d); err != nil || time.Since(d.Sent) > deliveryTTL {
+			expired = append(expired, key)
+			return nil
+		}
+		rc.mu.Lock()
+		rc.deliveries[d.EventID] = d
+		if d.FollowUpID != "" {
+			rc.deliveries[d.FollowUpID] = d
+		}
+		rc.armExpiryLocked(d)
+		rc.mu.Unlock()
+		rc.armFollowUp(ctx, cli, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := rc.store.Delete(key); err != nil {
+			log.Printf("reminder: error deleting expired delivery %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// HandleReaction acknowledges or snoozes a delivered reminder. Only the
+// recipient or the creator may react, except for room-wide reminders.
+func (rc *RemindMeCmd) HandleReaction(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
+	rel := evt.Content.AsReaction().RelatesTo
+	key := strings.TrimSuffix(rel.Key, "\ufe0f")
+
+	rc.mu.Lock()
+	d, ok := rc.deliveries[rel.EventID]
+	rc.mu.Unlock()
+	if !ok {
+		return
+	}
+	r := &d.Reminder
+	if !r.WholeRoom && evt.Sender != r.recipient() && evt.Sender != r.Sender {
+		return
+	}
+
+	switch key {
+	case reactAck:
+		rc.untrack(d)
+	case reactSnooze, reactSnooze2:
+		if rc.untrack(d) {
+			rc.snooze(ctx, cli, d)
+		}
+	}
+}
+
+// snooze re-schedules a delivered reminder as a new one-off reminder.
+func (rc *RemindMeCmd) snooze(ctx context.Context, cli *mautrix.Client, d *delivery) {
+	seq, err := rc.store.NextSequence()
+	if err != nil {
+		log.Printf("reminder: error allocating id: %v", err)
+		return
+	}
+	r := d.Reminder
+	r.ID = int64(seq)
+	r.Repeat = ""
+	r.Due = time.Now().Add(rc.Snooze)
+	if err := rc.store.PutJSON(reminderKey(r.ID), &r); err != nil {
+		log.Printf("reminder: error saving reminder: %v", err)
+		return
+	}
+	rc.arm(ctx, cli, &r)
+
+	loc := rc.location(r.recipient())
+	cli.SendText(ctx, r.RoomID, fmt.Sprintf("Snoozed reminder #%d until %s (now #%d)", d.Reminder.ID, formatTime(r.Due.In(loc)), r.ID))
+}
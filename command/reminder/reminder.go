@@ -2,127 +2,565 @@ package reminder
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/internal/matrixutil"
+	"github.com/hionay/rubyChan/state"
 )
 
-type RemindMeCmd struct{}
+const (
+	reminderKeyPrefix = "rem:"
+	tzKeyPrefix       = "tz:"
+
+	// retryDelay is how long a reminder waits after a failed delivery before
+	// the next attempt. It doubles with each failure, up to maxRetryDelay.
+	retryDelay    = 30 * time.Second
+	maxRetryDelay = 30 * time.Minute
+)
+
+type RemindMeCmd struct {
+	// Snooze is how long a ⏰ or 🔁 reaction postpones a delivered reminder.
+	Snooze time.Duration
+
+	store      *state.Namespace
+	mu         sync.Mutex
+	reminders  map[int64]*reminder
+	deliveries map[id.EventID]*delivery
+}
+
+func NewRemindMeCmd(store *state.Namespace) *RemindMeCmd {
+	return &RemindMeCmd{
+		Snooze:     DefaultSnooze,
+		store:      store,
+		reminders:  make(map[int64]*reminder),
+		deliveries: make(map[id.EventID]*delivery),
+	}
+}
 
 func (*RemindMeCmd) Name() string      { return "remindme" }
-func (*RemindMeCmd) Aliases() []string { return nil }
-func (*RemindMeCmd) Usage() string {
-	return `!remindme in <duration> <message> | !remindme list | !remindme cancel <id>`
+func (*RemindMeCmd) Aliases() []string { return []string{"remind"} }
+func (rc *RemindMeCmd) Usage() string  { return rc.Router().Usage() }
+
+func (*RemindMeCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Set one-off or recurring reminders", Examples: []string{"!remindme in 1h30m check the oven", "!remindme tomorrow 9am standup", "!remindme every friday 17:00 weekly report", "!remind room at 12:00 lunch", "!remindme list"}}
 }
 
-func (rc *RemindMeCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	if len(args) == 1 && args[0] == "list" {
-		list(ctx, cli, evt.RoomID, evt.Sender)
-	} else if len(args) == 2 && args[0] == "cancel" {
-		cancel(ctx, cli, evt.RoomID, evt.Sender, args[1])
-	} else {
-		rc.schedule(ctx, cli, evt.RoomID, evt.Sender, args)
+// Stateful keeps edits from running the command again. Every run schedules a reminder.
+func (*RemindMeCmd) Stateful() bool { return true }
+
+func (rc *RemindMeCmd) Router() *command.Router {
+	return &command.Router{
+		Command: "remindme",
+		Default: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+			rc.schedule(ctx, cli, evt, args)
+		},
+		DefaultUsage: `!remindme <when> <message> — when: in 1h30m | at 17:30 | tomorrow 9am | on 2026-12-24 18:00 | next friday` +
+			"\n!remindme every <interval|day|weekday|friday [20:00]|cron expr> <message> — Recurring reminder" +
+			"\n!remind <@user|room> <when|every ...> <message> — Remind someone else or the whole room",
+		FreeArgs: true,
+		Subcommands: []command.Subcommand{
+			{
+				Name:    "list",
+				Usage:   "!remindme list [all] — List your pending reminders, or the whole room's (moderators)",
+				MaxArgs: 1,
+				Handler: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+					if len(args) == 1 && args[0] != "all" {
+						command.ReplyUsage(ctx, cli, evt, "!remindme list [all]")
+						return
+					}
+					rc.list(ctx, cli, evt, len(args) == 1)
+				},
+			},
+			{
+				Name:    "cancel",
+				Usage:   "!remindme cancel <id> — Cancel a reminder, or a whole recurring series",
+				MaxArgs: 1,
+				Handler: rc.withID("cancel", rc.cancel),
+			},
+			{
+				Name:    "skip",
+				Usage:   "!remindme skip <id> — Skip the next occurrence of a recurring reminder",
+				MaxArgs: 1,
+				Handler: rc.withID("skip", rc.skip),
+			},
+			{
+				Name:    "tz",
+				Usage:   "!remindme tz [zone] — Show or set your time zone (e.g. Europe/Istanbul)",
+				MaxArgs: 1,
+				Handler: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+					rc.timezone(ctx, cli, evt, args)
+				},
+			},
+		},
 	}
 }
 
+func (rc *RemindMeCmd) withID(name string, fn func(context.Context, *mautrix.Client, *event.Event, string)) command.Handler {
+	return func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+		if len(args) != 1 {
+			command.ReplyUsage(ctx, cli, evt, fmt.Sprintf("!remindme %s <id>", name))
+			return
+		}
+		fn(ctx, cli, evt, args[0])
+	}
+}
+
+func (rc *RemindMeCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	rc.Router().Route(ctx, cli, evt, args)
+}
+
 type reminder struct {
-	ID      int64
-	Timer   *time.Timer
-	RoomID  id.RoomID
-	Sender  id.UserID
-	Message string
-	Due     time.Time
-}
-
-var (
-	reminders   = make(map[int64]*reminder)
-	remindersMu sync.Mutex
-	nextRemID   int64
-)
+	ID      int64     `json:"id"`
+	RoomID  id.RoomID `json:"room_id"`
+	Sender  id.UserID `json:"sender"`
+	Message string    `json:"message"`
+	Due     time.Time `json:"due"`
+	// Repeat is the schedule of a recurring reminder, empty for one-offs.
+	Repeat string `json:"repeat,omitempty"`
+	// Target is who gets mentioned, empty when it is the sender. WholeRoom
+	// reminders mention everyone instead.
+	Target    id.UserID `json:"target,omitempty"`
+	WholeRoom bool      `json:"whole_room,omitempty"`
+
+	timer    *time.Timer
+	failures int
+}
+
+func (r *reminder) recipient() id.UserID {
+	if r.Target != "" {
+		return r.Target
+	}
+	return r.Sender
+}
 
-func (rc *RemindMeCmd) schedule(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, sender id.UserID, args []string) {
-	if len(args) < 3 || args[0] != "in" {
-		cli.SendText(ctx, roomID, rc.Usage())
+// aimedAt reports whether the reminder is for user alone, as opposed to
+// someone else or the whole room.
+func (r *reminder) aimedAt(user id.UserID) bool {
+	return !r.WholeRoom && r.recipient() == user
+}
+
+// parseTarget strips an optional leading recipient ("me", "room" or a user
+// ID) from args.
+func parseTarget(args []string) (target id.UserID, wholeRoom bool, rest []string, err error) {
+	if len(args) == 0 {
+		return "", false, args, nil
+	}
+	switch strings.ToLower(args[0]) {
+	case "me":
+		return "", false, args[1:], nil
+	case "room", "@room", "everyone":
+		return "", true, args[1:], nil
+	}
+	if strings.HasPrefix(args[0], "@") {
+		target, err := command.ParseUserID(args[0])
+		return target, false, args[1:], err
+	}
+	return "", false, args, nil
+}
+
+func reminderKey(id int64) string {
+	return reminderKeyPrefix + strconv.FormatInt(id, 10)
+}
+
+// Restore reloads persisted reminders. Pending ones are re-armed and the ones
+// that came due while the bot was down are delivered right away, marked late.
+// Recently delivered reminders keep listening for reactions.
+func (rc *RemindMeCmd) Restore(ctx context.Context, cli *mautrix.Client) error {
+	if err := rc.restoreDeliveries(ctx, cli); err != nil {
+		return err
+	}
+
+	var loaded []*reminder
+	err := rc.store.ForEach(reminderKeyPrefix, func(key string, value []byte) error {
+		r := &reminder{}
+		if err := json.Unmarshal(value, r); err != nil {
+			log.Printf("reminder: skipping corrupt entry %s: %v", key, err)
+			return nil
+		}
+		loaded = append(loaded, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, r := range loaded {
+		if r.Due.After(now) {
+			rc.arm(ctx, cli, r)
+			continue
+		}
+		rc.mu.Lock()
+		rc.reminders[r.ID] = r
+		rc.mu.Unlock()
+		rc.deliver(ctx, cli, r, true)
+	}
+	log.Printf("reminder: restored %d reminders", len(loaded))
+	return nil
+}
+
+func (rc *RemindMeCmd) schedule(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	target, wholeRoom, args, err := parseTarget(args)
+	if err != nil {
+		command.Reply(ctx, cli, evt, "Invalid recipient: "+err.Error())
+		return
+	}
+	if target == evt.Sender {
+		target = ""
+	}
+	// The bot pings the room for the sender, so they need the power to do so
+	// themselves.
+	if wholeRoom && !matrixutil.CanNotifyRoom(ctx, cli, evt.RoomID, evt.Sender) && !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, "Sorry, only members who may notify the whole room can set reminders for it.")
+		return
+	}
+	loc := rc.location(evt.Sender)
+	var (
+		due    time.Time
+		repeat string
+		rest   []string
+	)
+	if len(args) > 0 && args[0] == "every" {
+		repeat, rest, err = parseEvery(args)
+		if err == nil {
+			due, err = nextOccurrence(repeat, time.Now(), loc)
+		}
+	} else {
+		due, rest, err = parseWhen(args, time.Now(), loc)
+	}
+	if errors.Is(err, errNoWhen) || (err == nil && len(rest) == 0) {
+		command.Reply(ctx, cli, evt, rc.Usage())
 		return
 	}
-	d, err := time.ParseDuration(args[1])
 	if err != nil {
-		cli.SendText(ctx, roomID, "Invalid duration (e.g. 15m, 1h30m)")
+		command.Reply(ctx, cli, evt, "Invalid time: "+err.Error())
+		return
+	}
+	seq, err := rc.store.NextSequence()
+	if err != nil {
+		log.Printf("reminder: error allocating id: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
-	msg := strings.Join(args[2:], " ")
-	id := atomic.AddInt64(&nextRemID, 1)
-	due := time.Now().Add(d)
 
-	timer := time.AfterFunc(d, func() {
-		m := fmt.Sprintf("⏰ Reminder #%d: %s", id, msg)
-		mention := fmt.Sprintf(
-			`<a href="https://matrix.to/#/%s">%s</a>`, sender, sender,
-		)
-		content := event.MessageEventContent{
-			MsgType:       event.MsgText,
-			Body:          fmt.Sprintf("%s: %s", sender, m),
-			Format:        event.FormatHTML,
-			FormattedBody: fmt.Sprintf("%s: %s", mention, m),
-		}
-		cli.SendMessageEvent(ctx, roomID, event.EventMessage, content)
-		remindersMu.Lock()
-		delete(reminders, id)
-		remindersMu.Unlock()
+	r := &reminder{
+		ID:      int64(seq),
+		RoomID:  evt.RoomID,
+		Sender:  evt.Sender,
+		Message: strings.Join(rest, " "),
+		Due:     due,
+		Repeat:  repeat,
+
+		Target:    target,
+		WholeRoom: wholeRoom,
+	}
+	if err := rc.store.PutJSON(reminderKey(r.ID), r); err != nil {
+		log.Printf("reminder: error saving reminder: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	rc.arm(ctx, cli, r)
+
+	forWhom := ""
+	switch {
+	case r.WholeRoom:
+		forWhom = " for the room"
+	case r.Target != "":
+		forWhom = " for " + matrixutil.DisplayNick(ctx, cli, evt.RoomID, r.Target.String())
+	}
+	if r.Repeat != "" {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Recurring reminder #%d%s set (%s), next at %s", r.ID, forWhom, describeRepeat(r.Repeat), formatTime(r.Due.In(loc))))
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Reminder #%d%s set for %s", r.ID, forWhom, formatTime(r.Due.In(loc))))
+}
+
+func (rc *RemindMeCmd) arm(ctx context.Context, cli *mautrix.Client, r *reminder) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.armLocked(ctx, cli, r)
+}
+
+// armLocked is arm for callers holding rc.mu.
+func (rc *RemindMeCmd) armLocked(ctx context.Context, cli *mautrix.Client, r *reminder) {
+	// The timer outlives the command that created it.
+	ctx = context.WithoutCancel(ctx)
+	r.timer = time.AfterFunc(time.Until(r.Due), func() {
+		rc.deliver(ctx, cli, r, false)
 	})
+	rc.reminders[r.ID] = r
+}
 
-	rem := &reminder{ID: id, Timer: timer, RoomID: roomID, Sender: sender, Message: msg, Due: due}
-	remindersMu.Lock()
-	reminders[id] = rem
-	remindersMu.Unlock()
+func (rc *RemindMeCmd) deliver(ctx context.Context, cli *mautrix.Client, r *reminder, late bool) {
+	msg := matrixutil.NewMessage()
+	switch {
+	case r.WholeRoom && matrixutil.CanNotifyRoom(ctx, cli, r.RoomID, cli.UserID):
+		msg.MentionRoom()
+	case r.WholeRoom:
+		msg.Text("Everyone")
+	default:
+		to := r.recipient()
+		msg.Mention(to, matrixutil.DisplayNick(ctx, cli, r.RoomID, to.String()))
+	}
+	if late {
+		msg.Textf(": ⏰ Reminder #%d (late, was due %s): %s", r.ID, formatTime(r.Due.In(rc.location(r.Sender))), r.Message)
+	} else {
+		msg.Textf(": ⏰ Reminder #%d: %s", r.ID, r.Message)
+	}
+	if r.WholeRoom || r.Target != "" {
+		msg.Text(" (from ").Pill(r.Sender, matrixutil.DisplayNick(ctx, cli, r.RoomID, r.Sender.String())).Text(")")
+	}
+	msg.Textf(" — react %s when done, %s to snooze", reactAck, reactSnooze)
+	resp, err := cli.SendMessageEvent(ctx, r.RoomID, event.EventMessage, msg.Content())
+	if err != nil {
+		log.Printf("reminder: failed to deliver #%d: %v", r.ID, err)
+		rc.retry(ctx, cli, r)
+		return
+	}
+	rc.track(ctx, cli, r, resp.EventID)
+	rc.mu.Lock()
+	r.failures = 0
+	rc.mu.Unlock()
 
-	cli.SendText(ctx, roomID, fmt.Sprintf("Reminder #%d set for %s", id, due.Format(time.RFC1123)))
+	if r.Repeat != "" {
+		rc.reschedule(ctx, cli, r, time.Now())
+		return
+	}
+	rc.mu.Lock()
+	delete(rc.reminders, r.ID)
+	rc.mu.Unlock()
+	if err := rc.store.Delete(reminderKey(r.ID)); err != nil {
+		log.Printf("reminder: error deleting reminder #%d: %v", r.ID, err)
+	}
 }
 
-func list(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, sender id.UserID) {
-	remindersMu.Lock()
-	defer remindersMu.Unlock()
+// retry tries a failed delivery again after a growing delay. The reminder
+// stays stored meanwhile, so a restart delivers it too.
+func (rc *RemindMeCmd) retry(ctx context.Context, cli *mautrix.Client, r *reminder) {
+	ctx = context.WithoutCancel(ctx)
 
-	var lines []string
-	for _, r := range reminders {
-		if r.RoomID == roomID && r.Sender == sender {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.reminders[r.ID] != r {
+		// Canceled meanwhile.
+		return
+	}
+	delay := maxRetryDelay
+	if r.failures < 16 {
+		delay = min(retryDelay<<r.failures, maxRetryDelay)
+	}
+	r.failures++
+	r.timer = time.AfterFunc(delay, func() {
+		rc.deliver(ctx, cli, r, true)
+	})
+}
+
+// reschedule moves a recurring reminder to its first occurrence after the
+// given time and re-arms it. Occurrences missed while the bot was down are not
+// replayed. A reminder canceled meanwhile stays canceled.
+func (rc *RemindMeCmd) reschedule(ctx context.Context, cli *mautrix.Client, r *reminder, after time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.reminders[r.ID] != r {
+		return
+	}
+	rc.rescheduleLocked(ctx, cli, r, after)
+}
+
+// rescheduleLocked is reschedule for callers holding rc.mu, who have checked
+// that r is still pending.
+func (rc *RemindMeCmd) rescheduleLocked(ctx context.Context, cli *mautrix.Client, r *reminder, after time.Time) {
+	loc := rc.location(r.Sender)
+	next := r.Due
+	var err error
+	for !next.After(after) {
+		if next, err = nextOccurrence(r.Repeat, next, loc); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("reminder: dropping recurring reminder #%d: %v", r.ID, err)
+		delete(rc.reminders, r.ID)
+		if err := rc.store.Delete(reminderKey(r.ID)); err != nil {
+			log.Printf("reminder: error deleting reminder #%d: %v", r.ID, err)
+		}
+		return
+	}
+	r.Due = next
+	if err := rc.store.PutJSON(reminderKey(r.ID), r); err != nil {
+		log.Printf("reminder: error saving reminder #%d: %v", r.ID, err)
+	}
+	rc.armLocked(ctx, cli, r)
+}
+
+func (rc *RemindMeCmd) list(ctx context.Context, cli *mautrix.Client, evt *event.Event, all bool) {
+	if all && !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, "Only room moderators can list everyone's reminders.")
+		return
+	}
+	loc := rc.location(evt.Sender)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var mine []*reminder
+	for _, r := range rc.reminders {
+		if r.RoomID == evt.RoomID && (all || r.Sender == evt.Sender || r.aimedAt(evt.Sender)) {
+			mine = append(mine, r)
+		}
+	}
+	slices.SortFunc(mine, func(a, b *reminder) int { return a.Due.Compare(b.Due) })
+
+	lines := make([]string, 0, len(mine))
+	for _, r := range mine {
+		who := ""
+		switch {
+		case r.WholeRoom:
+			who = " for the room"
+		case r.recipient() != evt.Sender:
+			who = " for " + matrixutil.DisplayNick(ctx, cli, evt.RoomID, r.recipient().String())
+		}
+		if r.Sender != evt.Sender {
+			who += " by " + matrixutil.DisplayNick(ctx, cli, evt.RoomID, r.Sender.String())
+		}
+		if r.Repeat != "" {
 			lines = append(lines,
-				fmt.Sprintf("#%d at %s: %s", r.ID, r.Due.Format("15:04:05 Jan 02"), r.Message),
+				fmt.Sprintf("#%d%s %s, next at %s: %s", r.ID, who, describeRepeat(r.Repeat), formatTime(r.Due.In(loc)), r.Message),
 			)
+			continue
 		}
+		lines = append(lines,
+			fmt.Sprintf("#%d%s at %s: %s", r.ID, who, formatTime(r.Due.In(loc)), r.Message),
+		)
 	}
-	if len(lines) == 0 {
-		cli.SendText(ctx, roomID, "You have no pending reminders.")
-	} else {
-		cli.SendText(ctx, roomID, "Your reminders:\n"+strings.Join(lines, "\n"))
+	switch {
+	case len(lines) == 0 && all:
+		command.Reply(ctx, cli, evt, "There are no pending reminders in this room.")
+	case len(lines) == 0:
+		command.Reply(ctx, cli, evt, "You have no pending reminders.")
+	case all:
+		command.Reply(ctx, cli, evt, "Reminders in this room:\n"+strings.Join(lines, "\n"))
+	default:
+		command.Reply(ctx, cli, evt, "Your reminders:\n"+strings.Join(lines, "\n"))
 	}
 }
 
-func cancel(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, sender id.UserID, idArg string) {
+func (rc *RemindMeCmd) cancel(ctx context.Context, cli *mautrix.Client, evt *event.Event, idArg string) {
 	rid, err := strconv.ParseInt(idArg, 10, 64)
 	if err != nil {
-		cli.SendText(ctx, roomID, "Invalid reminder ID")
+		command.Reply(ctx, cli, evt, "Invalid reminder ID")
 		return
 	}
 
-	remindersMu.Lock()
-	rem, ok := reminders[rid]
-	if ok && rem.RoomID == roomID && rem.Sender == sender {
-		rem.Timer.Stop()
-		delete(reminders, rid)
+	rem, ok := rc.lookup(ctx, cli, evt, rid)
+	if !ok {
+		return
+	}
+	rc.mu.Lock()
+	if rem.timer != nil {
+		rem.timer.Stop()
 	}
-	remindersMu.Unlock()
+	delete(rc.reminders, rid)
+	rc.mu.Unlock()
 
-	if ok {
-		cli.SendText(ctx, roomID, fmt.Sprintf("Canceled reminder #%d", rid))
-	} else {
-		cli.SendText(ctx, roomID, fmt.Sprintf("No reminder #%d found", rid))
+	if err := rc.store.Delete(reminderKey(rid)); err != nil {
+		log.Printf("reminder: error deleting reminder #%d: %v", rid, err)
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Canceled reminder #%d", rid))
+}
+
+// lookup finds a reminder in the room that the sender may manage: its creator
+// can, and so can room moderators. It replies with the reason when not found.
+func (rc *RemindMeCmd) lookup(ctx context.Context, cli *mautrix.Client, evt *event.Event, rid int64) (*reminder, bool) {
+	rc.mu.Lock()
+	rem, ok := rc.reminders[rid]
+	ok = ok && rem.RoomID == evt.RoomID
+	rc.mu.Unlock()
+
+	if !ok {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("No reminder #%d found", rid))
+		return nil, false
+	}
+	if rem.Sender != evt.Sender && !matrixutil.IsModerator(ctx, cli, evt.RoomID, evt.Sender) {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Reminder #%d belongs to someone else; only its creator or a moderator can change it.", rid))
+		return nil, false
+	}
+	return rem, true
+}
+
+// location returns the user's configured time zone, or the server's when the
+// user has not set one.
+func (rc *RemindMeCmd) location(user id.UserID) *time.Location {
+	name, err := rc.store.GetString(tzKeyPrefix + user.String())
+	if err != nil {
+		log.Printf("reminder: error loading time zone: %v", err)
+	}
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("reminder: invalid stored time zone %q: %v", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+func (rc *RemindMeCmd) timezone(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) == 0 {
+		loc := rc.location(evt.Sender)
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Your time zone is %s (now %s)", loc, formatTime(time.Now().In(loc))))
+		return
+	}
+	loc, err := time.LoadLocation(args[0])
+	if err != nil || args[0] == "" || strings.EqualFold(args[0], "local") {
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Unknown time zone %q (use an IANA name like Europe/Istanbul)", args[0]))
+		return
+	}
+	if err := rc.store.PutString(tzKeyPrefix+evt.Sender.String(), loc.String()); err != nil {
+		log.Printf("reminder: error saving time zone: %v", err)
+		command.Reply(ctx, cli, evt, "Internal error")
+		return
+	}
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Time zone set to %s (now %s)", loc, formatTime(time.Now().In(loc))))
+}
+
+func (rc *RemindMeCmd) skip(ctx context.Context, cli *mautrix.Client, evt *event.Event, idArg string) {
+	rid, err := strconv.ParseInt(idArg, 10, 64)
+	if err != nil {
+		command.Reply(ctx, cli, evt, "Invalid reminder ID")
+		return
+	}
+
+	rem, ok := rc.lookup(ctx, cli, evt, rid)
+	if !ok {
+		return
+	}
+	if rem.Repeat == "" {
+		command.Reply(ctx, cli, evt, command.Prefixed(ctx, fmt.Sprintf("Reminder #%d is not recurring; use !remindme cancel %d", rid, rid)))
+		return
+	}
+	rc.mu.Lock()
+	if rc.reminders[rid] != rem || rem.timer == nil || !rem.timer.Stop() {
+		rc.mu.Unlock()
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Reminder #%d is being delivered right now; skip the occurrence after it once it's out.", rid))
+		return
 	}
+	rc.rescheduleLocked(ctx, cli, rem, rem.Due)
+	next := rem.Due
+	rc.mu.Unlock()
+	command.Reply(ctx, cli, evt, fmt.Sprintf("Skipped the next occurrence of #%d, next at %s", rid, formatTime(next.In(rc.location(evt.Sender)))))
 }
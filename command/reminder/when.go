@@ -0,0 +1,171 @@
+package reminder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// The distroless image ships no zoneinfo of its own.
+	_ "time/tzdata"
+
+	"github.com/hionay/rubyChan/command"
+)
+
+// defaultHour is used when a day is given without a time of day.
+const defaultHour = 9
+
+var errNoWhen = errors.New("missing time")
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseWhen resolves the leading time expression of args against now in loc
+// and returns the due time along with the remaining arguments. Supported forms:
+//
+//	in 1h30m | in 2d
+//	at 17:30 | at 9pm
+//	today 18:00 | tomorrow [9am]
+//	on 2026-12-24 [18:00] | on friday [18:00]
+//	next friday [18:00]
+func parseWhen(args []string, now time.Time, loc *time.Location) (time.Time, []string, error) {
+	if len(args) < 2 {
+		return time.Time{}, nil, errNoWhen
+	}
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch strings.ToLower(args[0]) {
+	case "in":
+		d, err := command.ParseDuration(args[1])
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		return now.Add(d), args[2:], nil
+
+	case "at":
+		h, m, ok := parseClock(args[1])
+		if !ok {
+			return time.Time{}, nil, fmt.Errorf("invalid time %q (e.g. 17:30, 9am)", args[1])
+		}
+		due := atClock(today, h, m)
+		if !due.After(now) {
+			due = atClock(today.AddDate(0, 0, 1), h, m)
+		}
+		return due, args[2:], nil
+
+	case "today":
+		h, m, ok := parseClock(args[1])
+		if !ok {
+			return time.Time{}, nil, fmt.Errorf("invalid time %q (e.g. 17:30, 9am)", args[1])
+		}
+		return future(atClock(today, h, m), args[2:], now)
+
+	case "tomorrow":
+		due, rest := withOptionalClock(today.AddDate(0, 0, 1), args[1:])
+		return future(due, rest, now)
+
+	case "on":
+		if wd, ok := weekdays[strings.ToLower(args[1])]; ok {
+			due, rest := withOptionalClock(nextWeekday(today, wd), args[2:])
+			return future(due, rest, now)
+		}
+		day, err := time.ParseInLocation("2006-01-02", args[1], loc)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD or a weekday)", args[1])
+		}
+		due, rest := withOptionalClock(day, args[2:])
+		return future(due, rest, now)
+
+	case "next":
+		wd, ok := weekdays[strings.ToLower(args[1])]
+		if !ok {
+			return time.Time{}, nil, fmt.Errorf("invalid weekday %q", args[1])
+		}
+		due, rest := withOptionalClock(nextWeekday(today, wd), args[2:])
+		return future(due, rest, now)
+	}
+	return time.Time{}, nil, errNoWhen
+}
+
+func future(due time.Time, rest []string, now time.Time) (time.Time, []string, error) {
+	if !due.After(now) {
+		return time.Time{}, nil, fmt.Errorf("%s is in the past", formatTime(due))
+	}
+	return due, rest, nil
+}
+
+// withOptionalClock applies a leading time of day from args to day, falling
+// back to defaultHour when the next argument is not a time.
+func withOptionalClock(day time.Time, args []string) (time.Time, []string) {
+	if len(args) > 0 {
+		if h, m, ok := parseClock(args[0]); ok {
+			return atClock(day, h, m), args[1:]
+		}
+	}
+	return atClock(day, defaultHour, 0), args
+}
+
+func atClock(day time.Time, h, m int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+}
+
+// nextWeekday returns the first wd strictly after today.
+func nextWeekday(today time.Time, wd time.Weekday) time.Time {
+	diff := (int(wd) - int(today.Weekday()) + 7) % 7
+	if diff == 0 {
+		diff = 7
+	}
+	return today.AddDate(0, 0, diff)
+}
+
+// parseClock accepts 24-hour "17:30" and 12-hour "9am" / "9:30pm" forms.
+func parseClock(s string) (hour, minute int, ok bool) {
+	s = strings.ToLower(s)
+	pm := strings.HasSuffix(s, "pm")
+	twelve := pm || strings.HasSuffix(s, "am")
+	if twelve {
+		s = s[:len(s)-2]
+	} else if !strings.Contains(s, ":") {
+		return 0, 0, false
+	}
+
+	hs, ms, hasMin := strings.Cut(s, ":")
+	hour, err := strconv.Atoi(hs)
+	if err != nil {
+		return 0, 0, false
+	}
+	if hasMin {
+		if len(ms) != 2 {
+			return 0, 0, false
+		}
+		if minute, err = strconv.Atoi(ms); err != nil || minute > 59 {
+			return 0, 0, false
+		}
+	}
+	if twelve {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	if hour < 0 || hour > 23 || minute < 0 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("Mon Jan 02 15:04 MST")
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"context"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+)
+
+// Respond sends content as the answer to the command in evt: a reply to it,
+// inside its thread when it was sent in one. Only the command's sender and
+// the users already in content.Mentions are pinged, whatever pills the body
+// holds. Replies too long for one message are split or uploaded, as the
+// room's settings say.
+func Respond(ctx context.Context, cli *mautrix.Client, evt *event.Event, content *event.MessageEventContent) (*mautrix.RespSendEvent, error) {
+	content.RelatesTo = ReplyRelation(evt)
+	if content.Mentions == nil {
+		content.Mentions = &event.Mentions{}
+	}
+	content.Mentions.Add(evt.Sender)
+	if oversized(ctx, content) {
+		return respondLong(ctx, cli, evt, content)
+	}
+	return send(ctx, cli, evt.RoomID, content)
+}
+
+// Reply answers the command in evt with plain text.
+func Reply(ctx context.Context, cli *mautrix.Client, evt *event.Event, text string) (*mautrix.RespSendEvent, error) {
+	return Respond(ctx, cli, evt, &event.MessageEventContent{MsgType: event.MsgText, Body: text})
+}
+
+// ReplyUsage answers the command in evt with usage text, written with the
+// default prefix, as it reads in the room.
+func ReplyUsage(ctx context.Context, cli *mautrix.Client, evt *event.Event, usage string) (*mautrix.RespSendEvent, error) {
+	return Reply(ctx, cli, evt, "Usage: "+Prefixed(ctx, usage))
+}
+
+// ReplyRelation is the relation of an answer to the command in evt, for
+// events other than messages: a reply, in the command's thread if it has one.
+func ReplyRelation(evt *event.Event) *event.RelatesTo {
+	rel := (&event.RelatesTo{}).SetReplyTo(evt.ID)
+	if r, ok := evt.Content.Parsed.(event.Relatable); ok {
+		if root := r.OptionalGetRelatesTo().GetThreadParent(); root != "" {
+			rel.SetThread(root, evt.ID)
+		}
+	}
+	return rel
+}
@@ -6,6 +6,8 @@ import (
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type RepoCmd struct{}
@@ -14,8 +16,12 @@ func (*RepoCmd) Name() string      { return "repo" }
 func (*RepoCmd) Aliases() []string { return []string{} }
 func (*RepoCmd) Usage() string     { return "!repo - Display Github Repo for the codebase" }
 
+func (*RepoCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryBot, Summary: "Link the bot's source code"}
+}
+
 func (*RepoCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
-	_, err := cli.SendText(ctx, evt.RoomID, "https://github.com/hionay/rubyChan fork me daddy")
+	_, err := command.Reply(ctx, cli, evt, "https://github.com/hionay/rubyChan fork me daddy")
 	if err != nil {
 		log.Println("SendText error", err)
 	}
@@ -0,0 +1,256 @@
+package command
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	// EditWindow is how long after a command its edits still run it again.
+	EditWindow = 15 * time.Minute
+	// keepResponses is how long replies are remembered, so that redacting a
+	// command can still take its replies along.
+	keepResponses = 24 * time.Hour
+	// maxResponses bounds the number of commands remembered.
+	maxResponses = 5000
+)
+
+// Stateful is implemented by commands whose runs change state, such as
+// scheduling a reminder or pulling the roulette trigger. Editing a call to
+// one doesn't run it again.
+type Stateful interface {
+	Stateful() bool
+}
+
+func IsStateful(cmd Command) bool {
+	s, ok := cmd.(Stateful)
+	return ok && s.Stateful()
+}
+
+type reply struct {
+	ID id.EventID
+	// Editable replies are text messages a rerun can edit in place.
+	Editable bool
+}
+
+type response struct {
+	room    id.RoomID
+	sender  id.UserID
+	at      time.Time
+	final   bool
+	replies []reply
+}
+
+// Responses links command events to the messages the bot sent for them.
+// Commands answer through Respond, which records its sends in the execution
+// that Begin puts in the context; other replies, such as polls, are recorded
+// with TrackReply.
+//
+// When a command is edited, Begin with the edited event runs it again with
+// its earlier replies at hand: the first text messages Respond sends in the
+// new run become edits of the old ones, and End redacts whatever old replies
+// were not reused.
+type Responses struct {
+	mu    sync.Mutex
+	byCmd map[id.EventID]*response
+	order []id.EventID
+}
+
+func NewResponses() *Responses {
+	return &Responses{byCmd: make(map[id.EventID]*response)}
+}
+
+// execution collects the replies of one run of a command.
+type execution struct {
+	cmd    id.EventID
+	room   id.RoomID
+	sender id.UserID
+	at     time.Time
+
+	mu       sync.Mutex
+	previous []reply
+	slots    []id.EventID
+	sent     []reply
+	final    bool
+	done     bool
+}
+
+type executionKey struct{}
+
+func executionFrom(ctx context.Context) *execution {
+	e, _ := ctx.Value(executionKey{}).(*execution)
+	return e
+}
+
+// Begin starts tracking the replies to evt. If it is an edit of a tracked
+// command, cmdID is the command it edits and the returned context reuses
+// that command's replies; ok is false when the edit should be ignored, as it
+// comes too late, from someone else, or for a stateful command.
+func (r *Responses) Begin(ctx context.Context, evt *event.Event, cmdID id.EventID) (_ context.Context, ok bool) {
+	e := &execution{
+		cmd:    cmdID,
+		room:   evt.RoomID,
+		sender: evt.Sender,
+		at:     time.UnixMilli(evt.Timestamp),
+	}
+	if cmdID != evt.ID {
+		r.mu.Lock()
+		prev := r.byCmd[cmdID]
+		r.mu.Unlock()
+		if prev == nil || prev.final || prev.sender != evt.Sender || prev.room != evt.RoomID || time.Since(prev.at) > EditWindow {
+			return ctx, false
+		}
+		e.at = prev.at
+		e.previous = prev.replies
+		for _, rp := range prev.replies {
+			if rp.Editable {
+				e.slots = append(e.slots, rp.ID)
+			}
+		}
+	}
+	return context.WithValue(ctx, executionKey{}, e), true
+}
+
+// MarkStateful keeps later edits of the running command from running it
+// again.
+func MarkStateful(ctx context.Context, cmd Command) {
+	if e := executionFrom(ctx); e != nil && IsStateful(cmd) {
+		e.mu.Lock()
+		e.final = true
+		e.mu.Unlock()
+	}
+}
+
+// End stops tracking the run in ctx, remembers its replies and redacts the
+// replies of an earlier run it did not reuse.
+func (r *Responses) End(ctx context.Context, cli *mautrix.Client) {
+	e := executionFrom(ctx)
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.done = true
+	sent := slices.Clone(e.sent)
+	final := e.final
+	var stale []id.EventID
+	for _, rp := range e.previous {
+		if !slices.ContainsFunc(sent, func(s reply) bool { return s.ID == rp.ID }) {
+			stale = append(stale, rp.ID)
+		}
+	}
+	e.mu.Unlock()
+
+	r.remember(e.cmd, &response{room: e.room, sender: e.sender, at: e.at, final: final, replies: sent})
+
+	ctx = context.WithoutCancel(ctx)
+	for _, evtID := range stale {
+		if _, err := cli.RedactEvent(ctx, e.room, evtID, mautrix.ReqRedact{Reason: "command edited"}); err != nil {
+			log.Printf("command: error redacting stale reply %s: %v", evtID, err)
+		}
+	}
+}
+
+func (r *Responses) remember(cmdID id.EventID, resp *response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byCmd[cmdID]; !ok {
+		r.order = append(r.order, cmdID)
+	}
+	r.byCmd[cmdID] = resp
+	for len(r.order) > 0 {
+		oldest := r.byCmd[r.order[0]]
+		if len(r.order) <= maxResponses && oldest != nil && time.Since(oldest.at) < keepResponses {
+			break
+		}
+		delete(r.byCmd, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// Redact redacts the replies to a command that was redacted.
+func (r *Responses) Redact(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, cmdID id.EventID) {
+	r.mu.Lock()
+	resp := r.byCmd[cmdID]
+	delete(r.byCmd, cmdID)
+	r.mu.Unlock()
+	if resp == nil || resp.room != roomID {
+		return
+	}
+	for _, rp := range resp.replies {
+		if _, err := cli.RedactEvent(ctx, roomID, rp.ID, mautrix.ReqRedact{Reason: "command redacted"}); err != nil {
+			log.Printf("command: error redacting reply %s: %v", rp.ID, err)
+		}
+	}
+}
+
+// TrackReply records an event sent for the running command other than
+// through Respond, such as a poll, so that redacting the command takes it
+// along.
+func TrackReply(ctx context.Context, roomID id.RoomID, evtID id.EventID) {
+	if e := executionFrom(ctx); e != nil && e.room == roomID {
+		e.record(evtID, false)
+	}
+}
+
+// claim returns the earlier reply the next editable reply should replace, if
+// any is left.
+func (e *execution) claim() id.EventID {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done || len(e.slots) == 0 {
+		return ""
+	}
+	target := e.slots[0]
+	e.slots = e.slots[1:]
+	return target
+}
+
+func (e *execution) record(evtID id.EventID, editable bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.done {
+		e.sent = append(e.sent, reply{ID: evtID, Editable: editable})
+	}
+}
+
+// send sends content for the command running in ctx and records it. Text
+// replies of a rerun edit the earlier ones in place; the returned event ID is
+// then the edited reply's, so a command that goes on to edit or react to its
+// message acts on the message people see.
+func send(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, content *event.MessageEventContent) (*mautrix.RespSendEvent, error) {
+	e := executionFrom(ctx)
+	if e == nil || e.room != roomID {
+		return cli.SendMessageEvent(ctx, roomID, event.EventMessage, content)
+	}
+	editable := content.MsgType == event.MsgText || content.MsgType == event.MsgNotice
+	var target id.EventID
+	if editable {
+		target = e.claim()
+	}
+	if target == "" {
+		resp, err := cli.SendMessageEvent(ctx, roomID, event.EventMessage, content)
+		if err == nil {
+			e.record(resp.EventID, editable)
+		}
+		return resp, err
+	}
+
+	edit := *content
+	// The edited reply keeps its own relation, and whoever it mentions was
+	// pinged by it already.
+	edit.RelatesTo = nil
+	edit.SetEdit(target)
+	resp, err := cli.SendMessageEvent(ctx, roomID, event.EventMessage, &edit)
+	if err != nil {
+		return resp, err
+	}
+	e.record(target, true)
+	return &mautrix.RespSendEvent{EventID: target}, nil
+}
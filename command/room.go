@@ -0,0 +1,97 @@
+package command
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultPrefix   = "!"
+	DefaultLanguage = "en"
+)
+
+// RoomSettings are the per-room overrides set with !config. The zero value is
+// the default everywhere.
+type RoomSettings struct {
+	Prefix   string   `json:"prefix,omitempty"`
+	Disabled []string `json:"disabled,omitempty"`
+	Language string   `json:"language,omitempty"`
+	// Output is what happens to replies past MaxLines lines: OutputSplit or
+	// OutputFile.
+	Output   string `json:"output,omitempty"`
+	MaxLines int    `json:"max_lines,omitempty"`
+}
+
+// CommandPrefix is the prefix that starts a command in the room.
+func (s RoomSettings) CommandPrefix() string {
+	if s.Prefix == "" {
+		return DefaultPrefix
+	}
+	return s.Prefix
+}
+
+// Lang is the room's output language as an ISO 639-1 code.
+func (s RoomSettings) Lang() string {
+	if s.Language == "" {
+		return DefaultLanguage
+	}
+	return s.Language
+}
+
+// OutputMode is how the room gets replies too long for one message.
+func (s RoomSettings) OutputMode() string {
+	if s.Output == "" {
+		return OutputSplit
+	}
+	return s.Output
+}
+
+// LineLimit is the most lines a reply may have before OutputMode applies.
+func (s RoomSettings) LineLimit() int {
+	if s.MaxLines == 0 {
+		return DefaultMaxLines
+	}
+	return s.MaxLines
+}
+
+// Enabled reports whether cmd may run in the room.
+func (s RoomSettings) Enabled(cmd Command) bool {
+	return !slices.Contains(s.Disabled, cmd.Name())
+}
+
+type roomSettingsKey struct{}
+
+func WithRoomSettings(ctx context.Context, s RoomSettings) context.Context {
+	return context.WithValue(ctx, roomSettingsKey{}, s)
+}
+
+// RoomSettingsFrom returns the settings of the room a command runs in, or the
+// defaults outside of one.
+func RoomSettingsFrom(ctx context.Context) RoomSettings {
+	s, _ := ctx.Value(roomSettingsKey{}).(RoomSettings)
+	return s
+}
+
+// Language is the output language of the room a command runs in.
+func Language(ctx context.Context) string {
+	return RoomSettingsFrom(ctx).Lang()
+}
+
+// Prefixed rewrites text written with the default "!" prefix, such as usage
+// lines, for the room's prefix. Every word that starts with "!" and a letter
+// is taken for a command.
+func Prefixed(ctx context.Context, text string) string {
+	prefix := RoomSettingsFrom(ctx).CommandPrefix()
+	if prefix == DefaultPrefix {
+		return text
+	}
+	return commandRe.ReplaceAllStringFunc(text, func(m string) string {
+		i := strings.Index(m, DefaultPrefix)
+		return m[:i] + prefix + m[i+len(DefaultPrefix):]
+	})
+}
+
+// commandRe matches the prefix of a command written in text.
+var commandRe = regexp.MustCompile(`(?:^|[\s("'])!\pL`)
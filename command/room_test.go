@@ -0,0 +1,28 @@
+package command
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrefixed(t *testing.T) {
+	ctx := WithRoomSettings(context.Background(), RoomSettings{Prefix: "?"})
+	tests := []struct {
+		in, want string
+	}{
+		{"!config prefix <prefix>", "?config prefix <prefix>"},
+		{"Usage: !remindme list [all]", "Usage: ?remindme list [all]"},
+		{"!weather [location]\n!wf [location] — Alias for !weather forecast", "?weather [location]\n?wf [location] — Alias for ?weather forecast"},
+		{"Current round: none (start with !roulette)", "Current round: none (start with ?roulette)"},
+		{`React or "!quote yes"`, `React or "?quote yes"`},
+		{"Hello! Nice!", "Hello! Nice!"},
+	}
+	for _, tt := range tests {
+		if got := Prefixed(ctx, tt.in); got != tt.want {
+			t.Errorf("Prefixed(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := Prefixed(context.Background(), "!help"); got != "!help" {
+		t.Errorf("Prefixed with the default prefix = %q", got)
+	}
+}
@@ -3,10 +3,8 @@ package roulette
 import (
 	"context"
 	"fmt"
-	"html"
 	"log"
 	"math/rand"
-	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +12,7 @@ import (
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 
+	"github.com/hionay/rubyChan/command"
 	"github.com/hionay/rubyChan/internal/matrixutil"
 	"github.com/hionay/rubyChan/state"
 )
@@ -25,7 +24,31 @@ type RouletteCmd struct {
 
 func (*RouletteCmd) Name() string      { return "roulette" }
 func (*RouletteCmd) Aliases() []string { return []string{"r"} }
-func (*RouletteCmd) Usage() string     { return "!roulette - Play Russian Roulette | !roulette stats" }
+func (c *RouletteCmd) Usage() string   { return c.Router().Usage() }
+
+func (*RouletteCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryGames, Summary: "Play Russian Roulette", Examples: []string{"!roulette", "!roulette stats"}}
+}
+
+// Stateful keeps edits from running the command again. Every run pulls the trigger.
+func (*RouletteCmd) Stateful() bool { return true }
+
+func (c *RouletteCmd) Router() *command.Router {
+	return &command.Router{
+		Command:      "roulette",
+		Default:      c.locked(c.play),
+		DefaultUsage: "!roulette - Play Russian Roulette",
+		Subcommands: []command.Subcommand{
+			{Name: "stats", Usage: "!roulette stats - Show this room's roulette stats", Handler: c.locked(c.sendStats)},
+			{
+				Name:       "reset",
+				Usage:      "!roulette reset - Start a new round (only after 5 pulls, before the final one)",
+				Handler:    c.locked(c.resetRound),
+				Permission: command.Permission{Role: command.RoleModerator},
+			},
+		},
+	}
+}
 
 type roundState struct {
 	Click   int `json:"click"`
@@ -48,24 +71,17 @@ func (c *RouletteCmd) roomLock(roomID string) *sync.Mutex {
 }
 
 func (c *RouletteCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	roomID := evt.RoomID.String()
-	lock := c.roomLock(roomID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	if len(args) > 0 {
-		arg := strings.ToLower(args[0])
-		switch arg {
-		case "stats":
-			c.sendStats(ctx, cli, evt)
-		case "reset":
-			c.resetRound(ctx, cli, evt)
-		default:
-			cli.SendText(ctx, evt.RoomID, "Unknown subcommand. Usage: !roulette [stats|reset]")
-		}
-		return
+	c.Router().Route(ctx, cli, evt, args)
+}
+
+// locked runs fn under the room's lock.
+func (c *RouletteCmd) locked(fn func(context.Context, *mautrix.Client, *event.Event)) command.Handler {
+	return func(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+		lock := c.roomLock(evt.RoomID.String())
+		lock.Lock()
+		defer lock.Unlock()
+		fn(ctx, cli, evt)
 	}
-	c.play(ctx, cli, evt)
 }
 
 func (c *RouletteCmd) play(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
@@ -76,14 +92,14 @@ func (c *RouletteCmd) play(ctx context.Context, cli *mautrix.Client, evt *event.
 	rs := &roundState{}
 	if err := c.Store.GetJSON(roundKey, rs); err != nil {
 		log.Printf("roulette: error loading round state: %v", err)
-		cli.SendText(ctx, evt.RoomID, "Internal error")
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
 
 	ss := &statsState{}
 	if err := c.Store.GetJSON(statsKey, ss); err != nil {
 		log.Printf("roulette: error loading stats state: %v", err)
-		cli.SendText(ctx, evt.RoomID, "Internal error")
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
 	if ss.DeathsByUser == nil {
@@ -133,7 +149,12 @@ func (c *RouletteCmd) play(ctx context.Context, cli *mautrix.Client, evt *event.
 		log.Printf("roulette: error saving stats state: %v", err)
 	}
 
-	sendMentionReply(ctx, cli, evt, sender, reply)
+	msg := matrixutil.NewMessage().
+		Mention(evt.Sender, matrixutil.DisplayNick(ctx, cli, evt.RoomID, sender)).
+		Text(": " + reply)
+	if _, err := command.Respond(ctx, cli, evt, msg.Content()); err != nil {
+		log.Printf("roulette: failed to send reply: %v", err)
+	}
 }
 
 func (c *RouletteCmd) sendStats(ctx context.Context, cli *mautrix.Client, evt *event.Event) {
@@ -147,7 +168,7 @@ func (c *RouletteCmd) sendStats(ctx context.Context, cli *mautrix.Client, evt *e
 	ss := &statsState{}
 	if err := c.Store.GetJSON(statsKey, ss); err != nil {
 		log.Printf("roulette: error loading stats: %v", err)
-		cli.SendText(ctx, evt.RoomID, "Internal error")
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
 	if ss.DeathsByUser == nil {
@@ -157,7 +178,7 @@ func (c *RouletteCmd) sendStats(ctx context.Context, cli *mautrix.Client, evt *e
 		ss.SurvivesByUser = map[string]int{}
 	}
 
-	currentLine := "Current round: none (start with !roulette)"
+	currentLine := command.Prefixed(ctx, "Current round: none (start with !roulette)")
 	if rs.Chamber != 0 {
 		currentLine = fmt.Sprintf("Current round: %d/6 pulls (still alive)", rs.Click)
 	}
@@ -170,36 +191,15 @@ func (c *RouletteCmd) sendStats(ctx context.Context, cli *mautrix.Client, evt *e
 	topDeaths := matrixutil.TopN(ss.DeathsByUser, 3)
 	topSurv := matrixutil.TopN(ss.SurvivesByUser, 3)
 
-	plainMsg := fmt.Sprintf(
-		"Roulette stats (this room)\n%s\nAll-time: %d pulls • %d deaths • %.1f%% death rate\nLongest streak: %d survivals\nMost deaths: %s\nMost survivals: %s",
-		currentLine,
-		ss.TotalPulls, ss.TotalDeaths, deathRate,
-		ss.LongestStreak,
-		formatTopPlain(ctx, cli, evt.RoomID, topDeaths),
-		formatTopPlain(ctx, cli, evt.RoomID, topSurv),
-	)
-
-	htmlMsg := fmt.Sprintf(
-		`<b>Roulette stats</b> (this room)<br>%s<br>`+
-			`All-time: %d pulls • %d deaths • %.1f%% death rate<br>`+
-			`Longest streak: %d survivals<br>`+
-			`Most deaths: %s<br>`+
-			`Most survivals: %s`,
-		html.EscapeString(currentLine),
-		ss.TotalPulls, ss.TotalDeaths, deathRate,
-		ss.LongestStreak,
-		formatTopHTML(ctx, cli, evt.RoomID, topDeaths),
-		formatTopHTML(ctx, cli, evt.RoomID, topSurv),
-	)
-
-	content := event.MessageEventContent{
-		MsgType:       event.MsgText,
-		Body:          plainMsg,
-		Format:        event.FormatHTML,
-		FormattedBody: htmlMsg,
-	}
+	msg := matrixutil.NewMessage().
+		Bold("Roulette stats").Text(" (this room)").Line().
+		Text(currentLine).Line().
+		Textf("All-time: %d pulls • %d deaths • %.1f%% death rate", ss.TotalPulls, ss.TotalDeaths, deathRate).Line().
+		Textf("Longest streak: %d survivals", ss.LongestStreak).Line().
+		Text("Most deaths: ").Append(formatTop(ctx, cli, evt.RoomID, topDeaths)).Line().
+		Text("Most survivals: ").Append(formatTop(ctx, cli, evt.RoomID, topSurv))
 
-	if _, err := cli.SendMessageEvent(ctx, evt.RoomID, event.EventMessage, content); err != nil {
+	if _, err := command.Respond(ctx, cli, evt, msg.Content()); err != nil {
 		log.Printf("roulette: failed to send stats: %v", err)
 	}
 }
@@ -211,59 +211,32 @@ func (c *RouletteCmd) resetRound(ctx context.Context, cli *mautrix.Client, evt *
 	rs := &roundState{}
 	if err := c.Store.GetJSON(roundKey, rs); err != nil {
 		log.Printf("roulette: error loading round state: %v", err)
-		cli.SendText(ctx, evt.RoomID, "Internal error")
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
 	if rs.Click != 5 {
-		cli.SendText(ctx, evt.RoomID, "Cannot reset: round can be reset only after 5 pulls (before the final one).")
+		command.Reply(ctx, cli, evt, "Cannot reset: round can be reset only after 5 pulls (before the final one).")
 		return
 	}
 	if err := c.Store.Delete(roundKey); err != nil {
 		log.Printf("roulette: error deleting round state: %v", err)
-		cli.SendText(ctx, evt.RoomID, "Internal error")
+		command.Reply(ctx, cli, evt, "Internal error")
 		return
 	}
-	cli.SendText(ctx, evt.RoomID, "Round has been reset.")
+	command.Reply(ctx, cli, evt, "Round has been reset.")
 }
 
-func formatTopHTML(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, items []matrixutil.KV[int]) string {
+// formatTop lists the leading players by name, without notifying them.
+func formatTop(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, items []matrixutil.KV[int]) *matrixutil.Message {
+	msg := matrixutil.NewMessage()
 	if len(items) == 0 {
-		return "—"
-	}
-	parts := make([]string, 0, len(items))
-	for _, it := range items {
-		parts = append(parts, fmt.Sprintf("%s (%d)", matrixutil.MentionNickHTML(ctx, cli, roomID, it.K), it.V))
+		return msg.Text("—")
 	}
-	return strings.Join(parts, ", ")
-}
-
-func formatTopPlain(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, items []matrixutil.KV[int]) string {
-	if len(items) == 0 {
-		return "—"
-	}
-	parts := make([]string, 0, len(items))
-	for _, it := range items {
-		parts = append(parts, fmt.Sprintf("@%s (%d)", matrixutil.DisplayNick(ctx, cli, roomID, it.K), it.V))
-	}
-	return strings.Join(parts, ", ")
-}
-
-func sendMentionReply(ctx context.Context, cli *mautrix.Client, evt *event.Event, senderMXID, reply string) {
-	nick := matrixutil.DisplayNick(ctx, cli, evt.RoomID, senderMXID)
-
-	escMXID := html.EscapeString(senderMXID)
-	escNick := html.EscapeString(nick)
-	escReply := html.EscapeString(reply)
-
-	mention := fmt.Sprintf(`<a href="https://matrix.to/#/%s">@%s</a>`, escMXID, escNick)
-
-	content := event.MessageEventContent{
-		MsgType:       event.MsgText,
-		Body:          fmt.Sprintf("%s: %s", senderMXID, reply),
-		Format:        event.FormatHTML,
-		FormattedBody: fmt.Sprintf("%s: %s", mention, escReply),
-	}
-	if _, err := cli.SendMessageEvent(ctx, evt.RoomID, event.EventMessage, content); err != nil {
-		log.Printf("roulette: failed to send reply: %v", err)
+	for i, it := range items {
+		if i > 0 {
+			msg.Text(", ")
+		}
+		msg.Pill(id.UserID(it.K), matrixutil.DisplayNick(ctx, cli, roomID, it.K)).Textf(" (%d)", it.V)
 	}
+	return msg
 }
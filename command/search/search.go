@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+
+	"github.com/hionay/rubyChan/command"
 )
 
 type SearchCmd struct {
@@ -24,13 +27,22 @@ func (*SearchCmd) Usage() string {
 	return "!g <query> - Search Google for <query>"
 }
 
+func (*SearchCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Search Google", Examples: []string{"!g matrix protocol spec"}}
+}
+
+// Custom Search has a small daily quota, so searches are spaced out.
+func (*SearchCmd) Limits() command.Limits {
+	return command.Limits{Cooldown: 10 * time.Second, APICost: 1}
+}
+
 func (sc *SearchCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
 	if len(args) == 0 {
-		cli.SendText(ctx, evt.RoomID, "Usage: "+sc.Usage())
+		command.ReplyUsage(ctx, cli, evt, sc.Usage())
 		return
 	}
 	query := strings.Join(args, " ")
-	title, link, err := sc.searchGoogle(query)
+	title, link, err := sc.searchGoogle(ctx, query, command.Language(ctx))
 
 	var reply string
 	switch {
@@ -42,7 +54,7 @@ func (sc *SearchCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *even
 		reply = fmt.Sprintf("%s\n\n%s", title, link)
 	}
 
-	if _, err := cli.SendText(ctx, evt.RoomID, reply); err != nil {
+	if _, err := command.Reply(ctx, cli, evt, reply); err != nil {
 		log.Printf("SendText error (google): %v", err)
 	}
 }
@@ -54,17 +66,21 @@ type googleResponse struct {
 	} `json:"items"`
 }
 
-func (sc *SearchCmd) searchGoogle(query string) (title, link string, err error) {
+func (sc *SearchCmd) searchGoogle(ctx context.Context, query, lang string) (title, link string, err error) {
 	if sc.GoogleAPIKey == "" || sc.GoogleCX == "" {
 		return "", "", fmt.Errorf("Google API key or CX not set")
 	}
 
 	reqURL := fmt.Sprintf(
-		"https://www.googleapis.com/customsearch/v1?q=%s&key=%s&cx=%s&num=1",
-		url.QueryEscape(query), sc.GoogleAPIKey, sc.GoogleCX,
+		"https://www.googleapis.com/customsearch/v1?q=%s&key=%s&cx=%s&num=1&hl=%s",
+		url.QueryEscape(query), sc.GoogleAPIKey, sc.GoogleCX, lang,
 	)
 
-	resp, err := http.Get(reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", "", err
 	}
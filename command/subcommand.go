@@ -0,0 +1,181 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+)
+
+type Handler func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string)
+
+type Subcommand struct {
+	Name    string
+	Aliases []string
+	Usage   string
+	Handler Handler
+	// Permission is required on top of the command's own.
+	Permission Permission
+	// MaxArgs, when set, sends invocations with more arguments to the
+	// router's Default instead, so free text that happens to start with a
+	// subcommand name still works. NoArgs allows none.
+	MaxArgs int
+}
+
+const NoArgs = -1
+
+func (s *Subcommand) matches(name string) bool {
+	return strings.EqualFold(name, s.Name) || slices.ContainsFunc(s.Aliases, func(a string) bool {
+		return strings.EqualFold(name, a)
+	})
+}
+
+// Subcommander is implemented by commands with subcommands, so help can list
+// them and permissions can be checked before the command runs.
+type Subcommander interface {
+	Router() *Router
+}
+
+// Router dispatches a command's arguments to its subcommands.
+type Router struct {
+	Command     string
+	Subcommands []Subcommand
+	// Default runs when no subcommand is named. Unless FreeArgs is set it
+	// only runs for the bare command, and an unknown first word is an error.
+	Default      Handler
+	DefaultUsage string
+	FreeArgs     bool
+}
+
+func (r *Router) Route(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	if len(args) == 0 {
+		if r.Default != nil {
+			r.Default(ctx, cli, evt, args)
+		} else {
+			Reply(ctx, cli, evt, "Usage:\n"+Prefixed(ctx, r.Usage()))
+		}
+		return
+	}
+
+	sub, ok := r.Match(args)
+	if sub != nil && !ok {
+		ReplyUsage(ctx, cli, evt, sub.Usage)
+		return
+	}
+	if sub != nil {
+		if inv, ok := InvocationFrom(ctx); ok {
+			inv.Subcommand = sub.Name
+			inv.ArgText = strings.TrimSpace(strings.TrimPrefix(inv.ArgText, args[0]))
+			ctx = WithInvocation(ctx, inv)
+		}
+		sub.Handler(ctx, cli, evt, args[1:])
+		return
+	}
+
+	if r.FreeArgs && r.Default != nil {
+		r.Default(ctx, cli, evt, args)
+		return
+	}
+	Reply(ctx, cli, evt, r.unknown(RoomSettingsFrom(ctx).CommandPrefix(), args[0]))
+}
+
+// Match finds the subcommand args route to. It returns the subcommand and
+// false when it was named with too many arguments and there is no Default
+// to fall back to, and nil when args name no subcommand.
+func (r *Router) Match(args []string) (*Subcommand, bool) {
+	if len(args) == 0 {
+		return nil, true
+	}
+	for i := range r.Subcommands {
+		sub := &r.Subcommands[i]
+		if !sub.matches(args[0]) {
+			continue
+		}
+		if sub.MaxArgs != 0 && len(args)-1 > max(sub.MaxArgs, 0) {
+			if r.FreeArgs && r.Default != nil {
+				return nil, true
+			}
+			return sub, false
+		}
+		return sub, true
+	}
+	return nil, true
+}
+
+// Usage lists the default form followed by every subcommand, one per line.
+func (r *Router) Usage() string {
+	var lines []string
+	if r.DefaultUsage != "" {
+		lines = append(lines, r.DefaultUsage)
+	}
+	for _, sub := range r.Subcommands {
+		lines = append(lines, sub.Usage)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Router) unknown(prefix, name string) string {
+	names := make([]string, len(r.Subcommands))
+	for i, sub := range r.Subcommands {
+		names[i] = sub.Name
+	}
+	msg := fmt.Sprintf("Unknown subcommand %q for %s%s.", name, prefix, r.Command)
+	if s := Suggest(strings.ToLower(name), names); len(s) > 0 {
+		msg += fmt.Sprintf(" Did you mean %s?", strings.Join(s, " or "))
+	}
+	return msg + fmt.Sprintf(" Available: %s", strings.Join(names, ", "))
+}
+
+// Suggest returns the candidates close to word: those it is a prefix of, or
+// within a small edit distance of, closest first.
+func Suggest(word string, candidates []string) []string {
+	type scored struct {
+		name string
+		dist int
+	}
+	limit := 2
+	if len(word) <= 3 {
+		limit = 1
+	}
+	var out []scored
+	for _, c := range candidates {
+		d := editDistance(word, c)
+		if strings.HasPrefix(c, word) && len(word) >= 2 {
+			d = min(d, 1)
+		}
+		if d <= limit {
+			out = append(out, scored{c, d})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b scored) int { return a.dist - b.dist })
+	names := make([]string, len(out))
+	for i, s := range out {
+		names[i] = s.name
+	}
+	return names
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
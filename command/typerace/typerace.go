@@ -15,6 +15,7 @@ import (
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 
+	"github.com/hionay/rubyChan/command"
 	"github.com/hionay/rubyChan/internal/matrixutil"
 	"github.com/hionay/rubyChan/state"
 )
@@ -50,27 +51,46 @@ func NewTypeRaceCmd(store *state.Namespace) *TypeRaceCmd {
 
 func (*TypeRaceCmd) Name() string      { return "typerace" }
 func (*TypeRaceCmd) Aliases() []string { return []string{"t"} }
-func (*TypeRaceCmd) Usage() string {
-	return "!typerace - First to type the prompt wins | !typerace stats"
+func (c *TypeRaceCmd) Usage() string   { return c.Router().Usage() }
+
+func (*TypeRaceCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryGames, Summary: "First to type the prompt wins", Examples: []string{"!typerace", "!typerace stats"}}
 }
 
-func (c *TypeRaceCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
-	if len(args) > 0 && strings.ToLower(args[0]) == "stats" {
-		c.sendStats(ctx, cli, evt)
-		return
+// Stateful keeps edits from running the command again. Every run starts a race.
+func (*TypeRaceCmd) Stateful() bool { return true }
+
+func (c *TypeRaceCmd) Router() *command.Router {
+	return &command.Router{
+		Command:      "typerace",
+		Default:      c.start,
+		DefaultUsage: "!typerace - First to type the prompt wins",
+		Subcommands: []command.Subcommand{{
+			Name:  "stats",
+			Usage: "!typerace stats - Show this room's typerace stats",
+			Handler: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
+				c.sendStats(ctx, cli, evt)
+			},
+		}},
 	}
+}
 
+func (c *TypeRaceCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	c.Router().Route(ctx, cli, evt, args)
+}
+
+func (c *TypeRaceCmd) start(ctx context.Context, cli *mautrix.Client, evt *event.Event, _ []string) {
 	c.mu.Lock()
 	if _, ongoing := c.active[evt.RoomID]; ongoing {
 		c.mu.Unlock()
-		_, _ = cli.SendText(ctx, evt.RoomID, "a race is already in progress!")
+		_, _ = command.Reply(ctx, cli, evt, "a race is already in progress!")
 		return
 	}
 	c.mu.Unlock()
 
 	prompt, err := c.fetchPrompt(ctx)
 	if err != nil {
-		_, _ = cli.SendText(ctx, evt.RoomID, fmt.Sprintf("fetch error: %v", err))
+		_, _ = command.Reply(ctx, cli, evt, fmt.Sprintf("fetch error: %v", err))
 		return
 	}
 
@@ -79,7 +99,7 @@ func (c *TypeRaceCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *eve
 	c.mu.Lock()
 	if _, ongoing := c.active[evt.RoomID]; ongoing {
 		c.mu.Unlock()
-		_, _ = cli.SendText(ctx, evt.RoomID, "a race is already in progress!")
+		_, _ = command.Reply(ctx, cli, evt, "a race is already in progress!")
 		return
 	}
 	c.active[evt.RoomID] = &race{
@@ -89,8 +109,10 @@ func (c *TypeRaceCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *eve
 	}
 	c.mu.Unlock()
 
-	_, _ = cli.SendText(ctx, evt.RoomID, fmt.Sprintf("type this:\n\n%s", prompt))
+	_, _ = command.Reply(ctx, cli, evt, fmt.Sprintf("type this:\n\n%s", prompt))
 
+	// The race outlives the command's deadline.
+	ctx = context.WithoutCancel(ctx)
 	_ = time.AfterFunc(60*time.Second, func() {
 		c.mu.Lock()
 		r, still := c.active[evt.RoomID]
@@ -100,7 +122,7 @@ func (c *TypeRaceCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *eve
 		}
 		delete(c.active, evt.RoomID)
 		c.mu.Unlock()
-		_, _ = cli.SendText(ctx, evt.RoomID, "time's up! no one finished the race.")
+		_, _ = command.Reply(ctx, cli, evt, "time's up! no one finished the race.")
 	})
 }
 
@@ -131,12 +153,10 @@ func (c *TypeRaceCmd) HandleMessage(ctx context.Context, cli *mautrix.Client, ev
 	wpm := calculateWPM(r.prompt, elapsed)
 	c.recordWin(evt.RoomID, evt.Sender.String(), wpm)
 
-	_, _ = cli.SendText(ctx, evt.RoomID, fmt.Sprintf(
-		"%s wins! finished in %s (%d wpm)",
-		evt.Sender,
-		formatDuration(elapsed),
-		wpm,
-	))
+	msg := matrixutil.NewMessage().
+		Mention(evt.Sender, matrixutil.DisplayNick(ctx, cli, evt.RoomID, evt.Sender.String())).
+		Textf(" wins! finished in %s (%d wpm)", formatDuration(elapsed), wpm)
+	_, _ = command.Respond(ctx, cli, evt, msg.Content())
 }
 
 func (c *TypeRaceCmd) recordWin(roomID id.RoomID, sender string, wpm int) {
@@ -173,30 +193,28 @@ func (c *TypeRaceCmd) sendStats(ctx context.Context, cli *mautrix.Client, evt *e
 	ss := c.loadStats(key)
 
 	if ss.TotalRaces == 0 {
-		_, _ = cli.SendText(ctx, evt.RoomID, "no races have been completed in this room yet.")
+		_, _ = command.Reply(ctx, cli, evt, "no races have been completed in this room yet.")
 		return
 	}
 
 	top := matrixutil.TopN(ss.BestWPMByUser, 5)
 
-	plainMsg := fmt.Sprintf(
-		"TypeRace stats (this room)\nTotal races: %d\nTop 5 by best WPM:\n%s",
-		ss.TotalRaces,
-		formatTopPlain(ctx, cli, evt.RoomID, top, ss.WinsByUser),
-	)
-	htmlMsg := fmt.Sprintf(
-		"<b>TypeRace stats</b> (this room)<br>Total races: %d<br><b>Top 5 by best WPM:</b><br>%s",
-		ss.TotalRaces,
-		formatTopHTML(ctx, cli, evt.RoomID, top, ss.WinsByUser),
-	)
-
-	content := event.MessageEventContent{
-		MsgType:       event.MsgText,
-		Body:          plainMsg,
-		Format:        event.FormatHTML,
-		FormattedBody: htmlMsg,
+	rows := make([][]*matrixutil.Message, len(top))
+	for i, it := range top {
+		rows[i] = []*matrixutil.Message{
+			matrixutil.NewMessage().Textf("%d.", i+1),
+			matrixutil.NewMessage().Pill(id.UserID(it.K), matrixutil.DisplayNick(ctx, cli, evt.RoomID, it.K)),
+			matrixutil.NewMessage().Textf("%d wpm", it.V),
+			matrixutil.NewMessage().Textf("%d wins", ss.WinsByUser[it.K]),
+		}
 	}
-	if _, err := cli.SendMessageEvent(ctx, evt.RoomID, event.EventMessage, content); err != nil {
+	msg := matrixutil.NewMessage().
+		Bold("TypeRace stats").Text(" (this room)").Line().
+		Textf("Total races: %d", ss.TotalRaces).Line().
+		Bold("Top 5 by best WPM:").
+		Table(nil, rows...)
+
+	if _, err := command.Respond(ctx, cli, evt, msg.Content()); err != nil {
 		log.Printf("typerace: failed to send stats: %v", err)
 	}
 }
@@ -227,30 +245,6 @@ func (c *TypeRaceCmd) fetchPrompt(ctx context.Context) (string, error) {
 	return strings.ToLower(result.Quote), nil
 }
 
-func formatTopHTML(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, items []matrixutil.KV[int], wins map[string]int) string {
-	if len(items) == 0 {
-		return "—"
-	}
-	parts := make([]string, 0, len(items))
-	for i, it := range items {
-		parts = append(parts, fmt.Sprintf("%d. %s — %d wpm (%d wins)",
-			i+1, matrixutil.MentionNickHTML(ctx, cli, roomID, it.K), it.V, wins[it.K]))
-	}
-	return strings.Join(parts, "<br>")
-}
-
-func formatTopPlain(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, items []matrixutil.KV[int], wins map[string]int) string {
-	if len(items) == 0 {
-		return "—"
-	}
-	parts := make([]string, 0, len(items))
-	for i, it := range items {
-		parts = append(parts, fmt.Sprintf("%d. @%s — %d wpm (%d wins)",
-			i+1, matrixutil.DisplayNick(ctx, cli, roomID, it.K), it.V, wins[it.K]))
-	}
-	return strings.Join(parts, "\n")
-}
-
 func calculateWPM(text string, d time.Duration) int {
 	words := len(strings.Fields(text))
 	minutes := d.Minutes()
@@ -16,6 +16,7 @@ import (
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 
+	"github.com/hionay/rubyChan/command"
 	"github.com/hionay/rubyChan/state"
 )
 
@@ -57,34 +58,60 @@ type WeatherCmd struct {
 
 func (*WeatherCmd) Name() string      { return "weather" }
 func (*WeatherCmd) Aliases() []string { return []string{"w", "wf"} }
-func (*WeatherCmd) Usage() string {
-	return "!weather [location] — Show current weather for [location], or last used by you\n!weather forecast [location] — Show 3-day forecast\n!wf [location] — Alias for !weather forecast"
+func (wc *WeatherCmd) Usage() string  { return wc.Router().Usage() }
+
+func (*WeatherCmd) Doc() command.Doc {
+	return command.Doc{Category: command.CategoryTools, Summary: "Show the weather or a 3-day forecast", Examples: []string{"!weather Kadıköy", "!wf Berlin", "!weather"}}
+}
+
+func (wc *WeatherCmd) Router() *command.Router {
+	return &command.Router{
+		Command: "weather",
+		Default: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+			inv, _ := command.InvocationFrom(ctx)
+			wc.report(ctx, cli, evt, args, inv.Name == "wf")
+		},
+		DefaultUsage: "!weather [location] — Show current weather for [location], or last used by you\n!wf [location] — Alias for !weather forecast",
+		FreeArgs:     true,
+		Subcommands: []command.Subcommand{{
+			Name:    "forecast",
+			Aliases: []string{"f"},
+			Usage:   "!weather forecast [location] — Show 3-day forecast",
+			Handler: func(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+				wc.report(ctx, cli, evt, args, true)
+			},
+		}},
+	}
+}
+
+func (*WeatherCmd) Limits() command.Limits {
+	return command.Limits{Cooldown: 3 * time.Second, APICost: 1}
+}
+
+// Timeout leaves room for a geocoding lookup followed by the forecast call.
+func (*WeatherCmd) Timeout() time.Duration {
+	return 45 * time.Second
 }
 
 func (wc *WeatherCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string) {
+	wc.Router().Route(ctx, cli, evt, args)
+}
+
+func (wc *WeatherCmd) report(ctx context.Context, cli *mautrix.Client, evt *event.Event, args []string, forecast bool) {
 	user := evt.Sender
 	room := evt.RoomID
 
-	raw := strings.TrimSpace(evt.Content.AsMessage().Body)
-	forecast := len(args) > 0 && (args[0] == "forecast" || args[0] == "f")
-	if !forecast && (raw == "!wf" || strings.HasPrefix(raw, "!wf ")) {
-		forecast = true
-	}
-	if forecast && len(args) > 0 && (args[0] == "forecast" || args[0] == "f") {
-		args = args[1:]
-	}
-
 	var loc string
 	var err error
 	key := room.String() + "|" + user.String()
 	if len(args) == 0 {
 		loc, err = wc.Store.GetString(key)
 		if err != nil {
-			cli.SendText(ctx, room, fmt.Sprintf("error retrieving last location: %v", err))
+			command.Reply(ctx, cli, evt, fmt.Sprintf("error retrieving last location: %v", err))
 			return
 		}
 		if loc == "" {
-			cli.SendText(ctx, room, "Usage: "+wc.Usage())
+			command.ReplyUsage(ctx, cli, evt, wc.Usage())
 			return
 		}
 	} else {
@@ -93,11 +120,11 @@ func (wc *WeatherCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *eve
 
 	geo, err := geocode(ctx, loc)
 	if err != nil {
-		cli.SendText(ctx, room, fmt.Sprintf("error: %v", err))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("error: %v", err))
 		return
 	}
 	if geo == nil {
-		cli.SendText(ctx, room, fmt.Sprintf("Location not found: %s", loc))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("Location not found: %s", loc))
 		return
 	}
 
@@ -108,18 +135,18 @@ func (wc *WeatherCmd) Execute(ctx context.Context, cli *mautrix.Client, evt *eve
 		reply, err = getWeatherOfLocation(ctx, geo)
 	}
 	if err != nil {
-		cli.SendText(ctx, room, fmt.Sprintf("error: %v", err))
+		command.Reply(ctx, cli, evt, fmt.Sprintf("error: %v", err))
 		return
 	}
 
 	if len(args) > 0 {
 		if err := wc.Store.PutString(key, loc); err != nil {
-			cli.SendText(ctx, room, fmt.Sprintf("error saving location: %v", err))
+			command.Reply(ctx, cli, evt, fmt.Sprintf("error saving location: %v", err))
 			return
 		}
 	}
 
-	cli.SendText(ctx, room, reply)
+	command.Reply(ctx, cli, evt, reply)
 }
 
 type geoResult struct {
@@ -162,7 +189,7 @@ func geocodeOpenMeteo(ctx context.Context, location string) (*geoResult, error)
 	q := url.Values{
 		"name":     {location},
 		"count":    {"1"},
-		"language": {"en"},
+		"language": {command.Language(ctx)},
 		"format":   {"json"},
 	}
 	var res struct {
@@ -186,11 +213,12 @@ func geocodeOpenMeteo(ctx context.Context, location string) (*geoResult, error)
 
 func geocodeNominatim(ctx context.Context, location string) (*geoResult, error) {
 	q := url.Values{
-		"q":              {location},
-		"format":         {"jsonv2"},
-		"limit":          {"1"},
-		"addressdetails": {"1"},
-		"featureType":    {"settlement"},
+		"q":               {location},
+		"format":          {"jsonv2"},
+		"limit":           {"1"},
+		"addressdetails":  {"1"},
+		"featureType":     {"settlement"},
+		"accept-language": {command.Language(ctx)},
 	}
 	var res []struct {
 		Name    string `json:"name"`
@@ -0,0 +1,152 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// maxPending bounds the jobs queued for a single room; past it new ones are
+// dropped, so one flooded room cannot pile up work for the whole bot.
+const maxPending = 32
+
+// Pool runs jobs on a bounded number of workers. Jobs for the same room run
+// one at a time in the order they were submitted, while different rooms run
+// in parallel.
+type Pool struct {
+	sem chan struct{}
+
+	mu     sync.Mutex
+	queues map[id.RoomID][]func()
+	wg     sync.WaitGroup
+}
+
+func NewPool(workers int) *Pool {
+	return &Pool{
+		sem:    make(chan struct{}, max(workers, 1)),
+		queues: make(map[id.RoomID][]func()),
+	}
+}
+
+// Submit queues job behind the room's earlier jobs. It reports false when the
+// room's queue is full and the job was dropped.
+func (p *Pool) Submit(roomID id.RoomID, job func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q, busy := p.queues[roomID]
+	if len(q) >= maxPending {
+		return false
+	}
+	p.queues[roomID] = append(q, job)
+	if !busy {
+		p.wg.Add(1)
+		go p.drain(roomID)
+	}
+	return true
+}
+
+// drain runs the room's jobs until its queue is empty, holding a worker slot
+// only while a job runs.
+func (p *Pool) drain(roomID id.RoomID) {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		q := p.queues[roomID]
+		if len(q) == 0 {
+			delete(p.queues, roomID)
+			p.mu.Unlock()
+			return
+		}
+		job := q[0]
+		p.queues[roomID] = q[1:]
+		p.mu.Unlock()
+
+		p.sem <- struct{}{}
+		runJob(roomID, job)
+		<-p.sem
+	}
+}
+
+func runJob(roomID id.RoomID, job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("command: job in %s panicked: %v\n%s", roomID, r, debug.Stack())
+		}
+	}()
+	job()
+}
+
+// Wait blocks until every queued job has run.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Timed is implemented by commands that need a different deadline than the
+// default. A zero timeout keeps the default.
+type Timed interface {
+	Timeout() time.Duration
+}
+
+// Run executes cmd under a deadline, recovering from panics. When the command
+// crashes or runs out of time, the user is told so. Run returns once the
+// deadline passes even if the command is still running, so a stuck command
+// does not hold up the room's queue; it is left to notice its cancelled
+// context on its own.
+func Run(ctx context.Context, cli *mautrix.Client, evt *event.Event, cmd Command, args []string, timeout time.Duration) {
+	if t, ok := cmd.(Timed); ok && t.Timeout() > 0 {
+		timeout = t.Timeout()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- execute(ctx, cli, evt, cmd, args) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("command: !%s in %s: %v", cmd.Name(), evt.RoomID, err)
+			notify(ctx, cli, evt, fmt.Sprintf("Sorry, %s%s crashed. The error has been logged.", RoomSettingsFrom(ctx).CommandPrefix(), cmd.Name()))
+			return
+		}
+	case <-ctx.Done():
+		go func() {
+			if err := <-done; err != nil {
+				log.Printf("command: !%s in %s after cancellation: %v", cmd.Name(), evt.RoomID, err)
+			}
+		}()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("command: !%s in %s timed out after %s", cmd.Name(), evt.RoomID, timeout)
+		notify(ctx, cli, evt, fmt.Sprintf("Sorry, %s%s took too long and was cancelled.", RoomSettingsFrom(ctx).CommandPrefix(), cmd.Name()))
+	}
+}
+
+// notify sends a notice about the run itself, which must go out even though
+// ctx may already be cancelled.
+func notify(ctx context.Context, cli *mautrix.Client, evt *event.Event, text string) {
+	sCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	Reply(sCtx, cli, evt, text)
+}
+
+func execute(ctx context.Context, cli *mautrix.Client, evt *event.Event, cmd Command, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	cmd.Execute(ctx, cli, evt, args)
+	return nil
+}
@@ -2,9 +2,17 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/history"
 )
 
 const (
@@ -15,11 +23,31 @@ const (
 	envGoogleCX       = "GOOGLE_CX"
 	envWebhookAddr    = "WEBHOOK_ADDR"
 	envTenorAPIKey    = "TENOR_API_KEY"
+	envReminderSnooze = "REMINDER_SNOOZE"
+	envHistoryRetain  = "HISTORY_RETENTION"
+	envHistoryRooms   = "HISTORY_ROOM_RETENTION"
+	envQuoteBackend   = "QUOTE_BACKEND"
+	envQuoteSiteURL   = "QUOTE_SITE_URL"
+	envQuoteAPIURL    = "QUOTE_API_URL"
+	envQuoteAPIToken  = "QUOTE_API_TOKEN"
+	envBotAdmins      = "BOT_ADMINS"
+	envRateUser       = "RATE_LIMIT_USER"
+	envRateRoom       = "RATE_LIMIT_ROOM"
+	envAPIBudget      = "API_BUDGET"
+	envWorkers        = "COMMAND_WORKERS"
+	envCmdTimeout     = "COMMAND_TIMEOUT"
 )
 
 const (
 	defaultMatrixServer = "https://matrix-client.matrix.org"
 	defaultWebhookPort  = "8080"
+	defaultHistoryLimit = 10000
+	defaultQuoteBackend = "site"
+	defaultRateUser     = "5/20s"
+	defaultRateRoom     = "20/1m"
+	defaultAPIBudget    = "100/1h"
+	defaultWorkers      = 8
+	defaultCmdTimeout   = 30 * time.Second
 )
 
 type Config struct {
@@ -30,6 +58,18 @@ type Config struct {
 	GoogleCX       string
 	WebhookAddr    string
 	TenorAPIKey    string
+	ReminderSnooze time.Duration
+	History        history.Retention
+	QuoteBackend   string
+	QuoteSiteURL   string
+	QuoteAPIURL    string
+	QuoteAPIToken  string
+	BotAdmins      []id.UserID
+	RateUser       command.Rate
+	RateRoom       command.Rate
+	APIBudget      command.Rate
+	Workers        int
+	CommandTimeout time.Duration
 }
 
 func NewConfig() (*Config, error) {
@@ -51,6 +91,80 @@ func NewConfig() (*Config, error) {
 	}
 	tenorAPIKey := os.Getenv(envTenorAPIKey)
 
+	var reminderSnooze time.Duration
+	if v := os.Getenv(envReminderSnooze); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", envReminderSnooze, v)
+		}
+		reminderSnooze = d
+	}
+
+	retention, err := parseRetention(os.Getenv(envHistoryRetain), os.Getenv(envHistoryRooms))
+	if err != nil {
+		return nil, err
+	}
+
+	quoteBackend := os.Getenv(envQuoteBackend)
+	if quoteBackend == "" {
+		quoteBackend = defaultQuoteBackend
+	}
+	quoteAPIURL := os.Getenv(envQuoteAPIURL)
+	switch quoteBackend {
+	case "site", "local":
+	case "api":
+		if quoteAPIURL == "" {
+			return nil, fmt.Errorf("%s=api needs %s", envQuoteBackend, envQuoteAPIURL)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s %q (use site, api or local)", envQuoteBackend, quoteBackend)
+	}
+
+	var botAdmins []id.UserID
+	for entry := range strings.SplitSeq(os.Getenv(envBotAdmins), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		u := id.UserID(entry)
+		if _, _, err := u.ParseAndValidateRelaxed(); err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q", envBotAdmins, entry)
+		}
+		botAdmins = append(botAdmins, u)
+	}
+
+	var rates [3]command.Rate
+	for i, r := range []struct{ env, def string }{
+		{envRateUser, defaultRateUser},
+		{envRateRoom, defaultRateRoom},
+		{envAPIBudget, defaultAPIBudget},
+	} {
+		v := os.Getenv(r.env)
+		if v == "" {
+			v = r.def
+		}
+		if rates[i], err = command.ParseRate(v); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.env, err)
+		}
+	}
+
+	workers := defaultWorkers
+	if v := os.Getenv(envWorkers); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid %s %q", envWorkers, v)
+		}
+		workers = n
+	}
+	cmdTimeout := defaultCmdTimeout
+	if v := os.Getenv(envCmdTimeout); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", envCmdTimeout, v)
+		}
+		cmdTimeout = d
+	}
+
 	googleAPIKey := os.Getenv(envGoogleAPIKey)
 	googleCX := os.Getenv(envGoogleCX)
 
@@ -62,5 +176,44 @@ func NewConfig() (*Config, error) {
 		GoogleCX:       googleCX,
 		WebhookAddr:    webhookAddr,
 		TenorAPIKey:    tenorAPIKey,
+		ReminderSnooze: reminderSnooze,
+		History:        retention,
+		QuoteBackend:   quoteBackend,
+		QuoteSiteURL:   os.Getenv(envQuoteSiteURL),
+		QuoteAPIURL:    quoteAPIURL,
+		QuoteAPIToken:  os.Getenv(envQuoteAPIToken),
+		BotAdmins:      botAdmins,
+		RateUser:       rates[0],
+		RateRoom:       rates[1],
+		APIBudget:      rates[2],
+		Workers:        workers,
+		CommandTimeout: cmdTimeout,
 	}, nil
 }
+
+// parseRetention reads the default number of messages kept per room and the
+// per-room overrides, given as "!room:server=N,!other:server=M". A limit of 0
+// keeps everything.
+func parseRetention(def, rooms string) (history.Retention, error) {
+	r := history.Retention{Default: defaultHistoryLimit, Rooms: make(map[id.RoomID]int)}
+	if def != "" {
+		n, err := strconv.Atoi(def)
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("invalid %s %q", envHistoryRetain, def)
+		}
+		r.Default = n
+	}
+	for entry := range strings.SplitSeq(rooms, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		room, v, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(v)
+		if !ok || err != nil || n < 0 || !strings.HasPrefix(room, "!") {
+			return r, fmt.Errorf("invalid %s entry %q", envHistoryRooms, entry)
+		}
+		r.Rooms[id.RoomID(room)] = n
+	}
+	return r, nil
+}
@@ -0,0 +1,141 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	backfillPageSize = 100
+	// maxBackfill bounds the backfill of rooms whose history is unlimited.
+	maxBackfill = 10000
+)
+
+var backfillFilter = &mautrix.FilterPart{
+	Types: []event.Type{event.EventMessage, event.EventEncrypted, event.EventRedaction},
+}
+
+// Backfill pages backwards through the room's timeline and adds up to limit
+// messages to store, oldest first, applying the edits and redactions found
+// along the way. It stops early at the first page that reaches a message the
+// store already has, since everything before it was stored on an earlier
+// run. A limit of 0 means maxBackfill.
+func Backfill(ctx context.Context, cli *mautrix.Client, store Store, roomID id.RoomID, limit int) (int, error) {
+	return NewBackfiller(store, roomID, limit).Run(ctx, cli)
+}
+
+// Backfiller is a Backfill split in two: it notes the messages the store has
+// when created, and stops at those when run. Created before syncing, it can
+// run alongside the sync without mistaking live messages for the end of the
+// stored history.
+type Backfiller struct {
+	store  Store
+	roomID id.RoomID
+	limit  int
+	known  map[id.EventID]bool
+}
+
+func NewBackfiller(store Store, roomID id.RoomID, limit int) *Backfiller {
+	if limit <= 0 {
+		limit = maxBackfill
+	}
+	known := make(map[id.EventID]bool)
+	for _, m := range store.GetLast(roomID, limit) {
+		known[m.EventID] = true
+	}
+	return &Backfiller{store: store, roomID: roomID, limit: limit, known: known}
+}
+
+func (b *Backfiller) RoomID() id.RoomID { return b.roomID }
+
+// Run backfills the room and returns the number of messages added.
+func (b *Backfiller) Run(ctx context.Context, cli *mautrix.Client) (int, error) {
+	store, roomID, limit, known := b.store, b.roomID, b.limit, b.known
+	var (
+		events  []*event.Event
+		added   int
+		from    string
+		reached bool
+	)
+	for added < limit && !reached {
+		resp, err := cli.Messages(ctx, roomID, from, "", mautrix.DirectionBackward, backfillFilter, backfillPageSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+		for _, evt := range resp.Chunk {
+			if known[evt.ID] {
+				reached = true
+				break
+			}
+			evt.RoomID = roomID
+			if evt = backfillEvent(ctx, cli, evt); evt == nil {
+				continue
+			}
+			if evt.Type == event.EventMessage && evt.Content.AsMessage().RelatesTo.GetReplaceID() == "" {
+				if added == limit {
+					continue
+				}
+				added++
+			}
+			events = append(events, evt)
+		}
+		if resp.End == "" || len(resp.Chunk) == 0 {
+			break
+		}
+		from = resp.End
+	}
+
+	// Pages come newest first; apply them in server order.
+	for _, evt := range slices.Backward(events) {
+		if evt.Type == event.EventRedaction {
+			store.Redact(roomID, evt.Redacts)
+			continue
+		}
+		Record(store, evt)
+	}
+	return added, nil
+}
+
+// backfillEvent parses, and decrypts if needed, an event from /messages. It
+// returns nil for events that carry nothing to store, such as messages that
+// were redacted.
+func backfillEvent(ctx context.Context, cli *mautrix.Client, evt *event.Event) *event.Event {
+	evt.Type.Class = event.MessageEventType
+	if err := evt.Content.ParseRaw(evt.Type); err != nil && !errors.Is(err, event.ErrContentAlreadyParsed) {
+		return nil
+	}
+	if evt.Type == event.EventEncrypted {
+		if cli.Crypto == nil {
+			return nil
+		}
+		decrypted, err := cli.Crypto.Decrypt(ctx, evt)
+		if err != nil {
+			log.Printf("history: failed to decrypt %s: %v", evt.ID, err)
+			return nil
+		}
+		evt = decrypted
+	}
+	switch evt.Type {
+	case event.EventRedaction:
+		if evt.Redacts == "" {
+			evt.Redacts = evt.Content.AsRedaction().Redacts
+		}
+		if evt.Redacts == "" {
+			return nil
+		}
+	case event.EventMessage:
+		if evt.Content.AsMessage().Body == "" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return evt
+}
@@ -1,17 +1,94 @@
 package history
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 
+	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
 
 type HistoryMessage struct {
-	Sender    string
-	Body      string
-	Timestamp int64
+	Sender        string
+	SenderID      id.UserID
+	EventID       id.EventID
+	MsgType       event.MessageType
+	Body          string
+	FormattedBody string
+	Timestamp     int64
 }
 
+// Text renders the message for quoting: media become a "[image: name]"
+// placeholder instead of a bare file name.
+func (m HistoryMessage) Text() string {
+	var kind string
+	switch m.MsgType {
+	case event.MsgImage:
+		kind = "image"
+	case event.MsgVideo:
+		kind = "video"
+	case event.MsgAudio:
+		kind = "audio"
+	case event.MsgFile:
+		kind = "file"
+	case event.MsgLocation:
+		kind = "location"
+	default:
+		return m.Body
+	}
+	return fmt.Sprintf("[%s: %s]", kind, m.Body)
+}
+
+// FromEvent converts a parsed m.room.message event into a HistoryMessage.
+// For an edit it returns the edited content along with the ID of the event
+// it replaces.
+func FromEvent(evt *event.Event) (HistoryMessage, id.EventID) {
+	msg := evt.Content.AsMessage()
+	msg.RemoveReplyFallback()
+	replaces := msg.RelatesTo.GetReplaceID()
+	if replaces != "" && msg.NewContent != nil {
+		msg = msg.NewContent
+	}
+	return HistoryMessage{
+		Sender:        evt.Sender.Localpart(),
+		SenderID:      evt.Sender,
+		EventID:       evt.ID,
+		MsgType:       msg.MsgType,
+		Body:          strings.TrimSpace(msg.Body),
+		FormattedBody: msg.FormattedBody,
+		Timestamp:     evt.Timestamp,
+	}, replaces
+}
+
+// Record adds a message event to store, or applies it to the message it
+// edits. For edits it returns the ID of the edited message.
+func Record(store Store, evt *event.Event) (HistoryMessage, id.EventID) {
+	msg, replaces := FromEvent(evt)
+	if replaces != "" {
+		store.Replace(evt.RoomID, replaces, msg)
+		return msg, replaces
+	}
+	store.Add(evt.RoomID, msg)
+	return msg, ""
+}
+
+// Store records room messages and hands back the most recent ones. Messages
+// are kept in server timestamp order whatever order they are added in, and
+// adding an event that is already stored is a no-op.
+type Store interface {
+	Add(roomID id.RoomID, msg HistoryMessage)
+	GetLast(roomID id.RoomID, n int) []HistoryMessage
+	// Replace applies an edit to the stored message with the given ID. Only
+	// the original sender's edits are applied, and the message keeps its
+	// place in history.
+	Replace(roomID id.RoomID, eventID id.EventID, edit HistoryMessage)
+	// Redact forgets the message with the given ID.
+	Redact(roomID id.RoomID, eventID id.EventID)
+}
+
+// HistoryStore is an in-memory Store keeping the last limit messages per room.
 type HistoryStore struct {
 	mu    sync.Mutex
 	data  map[id.RoomID][]HistoryMessage
@@ -30,7 +107,14 @@ func (hs *HistoryStore) Add(roomID id.RoomID, msg HistoryMessage) {
 	defer hs.mu.Unlock()
 
 	hist := hs.data[roomID]
-	hist = append(hist, msg)
+	if msg.EventID != "" && slices.ContainsFunc(hist, func(m HistoryMessage) bool { return m.EventID == msg.EventID }) {
+		return
+	}
+	i := len(hist)
+	for i > 0 && hist[i-1].Timestamp > msg.Timestamp {
+		i--
+	}
+	hist = slices.Insert(hist, i, msg)
 	if len(hist) > hs.limit {
 		hist = hist[len(hist)-hs.limit:]
 	}
@@ -47,3 +131,24 @@ func (hs *HistoryStore) GetLast(roomID id.RoomID, n int) []HistoryMessage {
 	}
 	return append([]HistoryMessage(nil), hist[len(hist)-n:]...)
 }
+
+func (hs *HistoryStore) Replace(roomID id.RoomID, eventID id.EventID, edit HistoryMessage) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hist := hs.data[roomID]
+	i := slices.IndexFunc(hist, func(m HistoryMessage) bool { return m.EventID == eventID })
+	if i < 0 || hist[i].SenderID != edit.SenderID {
+		return
+	}
+	hist[i].MsgType = edit.MsgType
+	hist[i].Body = edit.Body
+	hist[i].FormattedBody = edit.FormattedBody
+}
+
+func (hs *HistoryStore) Redact(roomID id.RoomID, eventID id.EventID) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.data[roomID] = slices.DeleteFunc(hs.data[roomID], func(m HistoryMessage) bool { return m.EventID == eventID })
+}
@@ -0,0 +1,264 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// migrations upgrade the history database one schema version at a time. The
+// current version is kept in SQLite's user_version.
+var migrations = []string{
+	`
+CREATE TABLE IF NOT EXISTS messages (
+	id             INTEGER PRIMARY KEY,
+	room_id        TEXT    NOT NULL,
+	event_id       TEXT    NOT NULL,
+	sender         TEXT    NOT NULL,
+	sender_nick    TEXT    NOT NULL,
+	timestamp      INTEGER NOT NULL,
+	body           TEXT    NOT NULL,
+	formatted_body TEXT    NOT NULL DEFAULT '',
+	UNIQUE (room_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS messages_room_ts ON messages (room_id, timestamp);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5 (
+	body, content = 'messages', content_rowid = 'id'
+);
+CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_ad AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_au AFTER UPDATE OF body ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+	INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+`,
+	`ALTER TABLE messages ADD COLUMN msgtype TEXT NOT NULL DEFAULT 'm.text';`,
+}
+
+// Retention caps how many messages are kept per room. Rooms without an
+// entry in Rooms keep Default messages; a value of 0 keeps everything.
+type Retention struct {
+	Default int
+	Rooms   map[id.RoomID]int
+}
+
+// Limit returns the number of messages kept for the room.
+func (r Retention) Limit(roomID id.RoomID) int {
+	if n, ok := r.Rooms[roomID]; ok {
+		return n
+	}
+	return r.Default
+}
+
+// pruneMargin is how far, as a fraction of its limit, a room may grow past
+// its retention limit before it is pruned, so that pruning runs in batches
+// rather than on every message.
+const pruneMargin = 20
+
+// SQLiteStore is a persistent Store with a full-text index over message
+// bodies.
+type SQLiteStore struct {
+	db        *sql.DB
+	retention Retention
+
+	mu sync.Mutex
+	// added counts the messages stored per room since it was last pruned.
+	added map[id.RoomID]int
+}
+
+func NewSQLiteStore(ctx context.Context, db *sql.DB, retention Retention) (*SQLiteStore, error) {
+	if err := migrate(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to migrate history schema: %w", err)
+	}
+	return &SQLiteStore{db: db, retention: retention, added: make(map[id.RoomID]int)}, nil
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("version %d: %w", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Add stores msg, ignoring events that are already stored. Once enough
+// messages have been added, the room is pruned down to its retention limit.
+func (s *SQLiteStore) Add(roomID id.RoomID, msg HistoryMessage) {
+	ctx := context.Background()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO messages (room_id, event_id, sender, sender_nick, timestamp, msgtype, body, formatted_body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		roomID, msg.EventID, msg.SenderID, msg.Sender, msg.Timestamp, msg.MsgType, msg.Body, msg.FormattedBody,
+	)
+	if err != nil {
+		log.Printf("history: failed to store message: %v", err)
+		return
+	}
+	n := s.retention.Limit(roomID)
+	if inserted, _ := res.RowsAffected(); n <= 0 || inserted == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.added[roomID]++
+	due := s.added[roomID] >= max(n/pruneMargin, 1)
+	if due {
+		s.added[roomID] = 0
+	}
+	s.mu.Unlock()
+	if due {
+		if err := s.prune(ctx, roomID, n); err != nil {
+			log.Printf("history: failed to prune room %s: %v", roomID, err)
+		}
+	}
+}
+
+// prune deletes all but the newest n messages of the room. It finds the
+// oldest message to keep through the (room_id, timestamp) index, then deletes
+// everything before it.
+func (s *SQLiteStore) prune(ctx context.Context, roomID id.RoomID, n int) error {
+	var ts, rowID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT timestamp, id FROM messages WHERE room_id = ?
+		ORDER BY timestamp DESC, id DESC LIMIT 1 OFFSET ?`, roomID, n-1).Scan(&ts, &rowID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM messages
+		WHERE room_id = ? AND (timestamp < ? OR (timestamp = ? AND id < ?))`,
+		roomID, ts, ts, rowID)
+	return err
+}
+
+func (s *SQLiteStore) GetLast(roomID id.RoomID, n int) []HistoryMessage {
+	rows, err := s.db.QueryContext(context.Background(), `
+		SELECT sender_nick, sender, event_id, msgtype, body, formatted_body, timestamp
+		FROM messages WHERE room_id = ?
+		ORDER BY timestamp DESC, id DESC LIMIT ?`, roomID, n)
+	if err != nil {
+		log.Printf("history: failed to load messages: %v", err)
+		return nil
+	}
+	msgs, err := scanMessages(rows)
+	if err != nil {
+		log.Printf("history: failed to load messages: %v", err)
+		return nil
+	}
+	slices.Reverse(msgs)
+	return msgs
+}
+
+func (s *SQLiteStore) Replace(roomID id.RoomID, eventID id.EventID, edit HistoryMessage) {
+	_, err := s.db.ExecContext(context.Background(), `
+		UPDATE messages SET msgtype = ?, body = ?, formatted_body = ?
+		WHERE room_id = ? AND event_id = ? AND sender = ?`,
+		edit.MsgType, edit.Body, edit.FormattedBody, roomID, eventID, edit.SenderID,
+	)
+	if err != nil {
+		log.Printf("history: failed to apply edit to %s: %v", eventID, err)
+	}
+}
+
+func (s *SQLiteStore) Redact(roomID id.RoomID, eventID id.EventID) {
+	_, err := s.db.ExecContext(context.Background(),
+		`DELETE FROM messages WHERE room_id = ? AND event_id = ?`, roomID, eventID)
+	if err != nil {
+		log.Printf("history: failed to redact %s: %v", eventID, err)
+	}
+}
+
+// SearchQuery narrows a full-text search. Terms are matched as words, all of
+// which must appear; From and Before are optional.
+type SearchQuery struct {
+	Terms  []string
+	From   string
+	Before time.Time
+	Limit  int
+}
+
+// Search returns the newest messages in the room matching q, newest first.
+// From matches either the sender's MXID or their nick.
+func (s *SQLiteStore) Search(ctx context.Context, roomID id.RoomID, q SearchQuery) ([]HistoryMessage, error) {
+	if len(q.Terms) == 0 {
+		return nil, fmt.Errorf("no search terms")
+	}
+	quoted := make([]string, len(q.Terms))
+	for i, t := range q.Terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+
+	query := `
+		SELECT m.sender_nick, m.sender, m.event_id, m.msgtype, m.body, m.formatted_body, m.timestamp
+		FROM messages_fts JOIN messages m ON m.id = messages_fts.rowid
+		WHERE messages_fts MATCH ? AND m.room_id = ?`
+	args := []any{strings.Join(quoted, " "), roomID}
+	if q.From != "" {
+		query += ` AND (m.sender = ? OR m.sender_nick = ?)`
+		args = append(args, q.From, q.From)
+	}
+	if !q.Before.IsZero() {
+		query += ` AND m.timestamp < ?`
+		args = append(args, q.Before.UnixMilli())
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	query += ` ORDER BY m.timestamp DESC, m.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func scanMessages(rows *sql.Rows) ([]HistoryMessage, error) {
+	defer rows.Close()
+	var msgs []HistoryMessage
+	for rows.Next() {
+		var m HistoryMessage
+		if err := rows.Scan(&m.Sender, &m.SenderID, &m.EventID, &m.MsgType, &m.Body, &m.FormattedBody, &m.Timestamp); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
@@ -3,12 +3,11 @@ package matrixutil
 import (
 	"cmp"
 	"context"
-	"fmt"
-	"html"
 	"sort"
 	"strings"
 
 	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
 
@@ -48,8 +47,63 @@ func DisplayNick(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, mxi
 	return mxid
 }
 
-func MentionNickHTML(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, mxid string) string {
-	nick := DisplayNick(ctx, cli, roomID, mxid)
-	return fmt.Sprintf(`<a href="https://matrix.to/#/%s">@%s</a>`,
-		html.EscapeString(mxid), html.EscapeString(nick))
+// ModeratorLevel and AdminLevel are the power levels clients present as
+// "Moderator" and "Admin".
+const (
+	ModeratorLevel = 50
+	AdminLevel     = 100
+)
+
+// botAdmins count as admins in every room, whatever their power level. It is
+// set once at startup.
+var botAdmins = make(map[id.UserID]bool)
+
+// SetBotAdmins sets the users configured as bot admins.
+func SetBotAdmins(users []id.UserID) {
+	botAdmins = make(map[id.UserID]bool, len(users))
+	for _, u := range users {
+		botAdmins[u] = true
+	}
+}
+
+func IsBotAdmin(userID id.UserID) bool {
+	return botAdmins[userID]
+}
+
+// PowerLevels returns the room's m.room.power_levels content, preferring the
+// client's state store over a round trip to the homeserver.
+func PowerLevels(ctx context.Context, cli *mautrix.Client, roomID id.RoomID) (*event.PowerLevelsEventContent, error) {
+	if cli.StateStore != nil {
+		if pl, err := cli.StateStore.GetPowerLevels(ctx, roomID); err == nil && pl != nil {
+			return pl, nil
+		}
+	}
+	pl := &event.PowerLevelsEventContent{}
+	if err := cli.StateEvent(ctx, roomID, event.StatePowerLevels, "", pl); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
+
+// IsModerator reports whether the user has at least moderator power in the
+// room, or is a bot admin. Lookup failures are treated as not a moderator.
+func IsModerator(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, userID id.UserID) bool {
+	if IsBotAdmin(userID) {
+		return true
+	}
+	pl, err := PowerLevels(ctx, cli, roomID)
+	if err != nil {
+		return false
+	}
+	return pl.GetUserLevel(userID) >= ModeratorLevel
+}
+
+// CanNotifyRoom reports whether the user may send @room notifications in the
+// room. Lookup failures are treated as not allowed.
+func CanNotifyRoom(ctx context.Context, cli *mautrix.Client, roomID id.RoomID, userID id.UserID) bool {
+	pl, err := PowerLevels(ctx, cli, roomID)
+	if err != nil {
+		return false
+	}
+	return pl.GetUserLevel(userID) >= pl.Notifications.Room()
 }
@@ -0,0 +1,260 @@
+package matrixutil
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// Message builds a message's plain body and its HTML formatting from one
+// description, escaping all text for HTML and collecting who it notifies for
+// m.mentions. Pills only notify when added with Mention.
+type Message struct {
+	plain, html strings.Builder
+	mentions    []id.UserID
+	room        bool
+	// afterBlock is set after a list or table, which end their line in HTML
+	// but not in the plain body.
+	afterBlock bool
+	// startsBlock is set when the message starts with a list or table, which
+	// need a line of their own wherever it is appended.
+	startsBlock bool
+}
+
+func NewMessage() *Message {
+	return &Message{}
+}
+
+func (m *Message) write(plain, rich string) *Message {
+	if m.afterBlock {
+		m.afterBlock = false
+		if !strings.HasPrefix(plain, "\n") {
+			m.plain.WriteByte('\n')
+		}
+	}
+	m.plain.WriteString(plain)
+	m.html.WriteString(rich)
+	return m
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// Text adds plain text. Line breaks are kept.
+func (m *Message) Text(s string) *Message {
+	return m.write(s, escape(s))
+}
+
+func (m *Message) Textf(format string, a ...any) *Message {
+	return m.Text(fmt.Sprintf(format, a...))
+}
+
+func (m *Message) Bold(s string) *Message {
+	return m.write(s, "<b>"+escape(s)+"</b>")
+}
+
+func (m *Message) Italic(s string) *Message {
+	return m.write(s, "<i>"+escape(s)+"</i>")
+}
+
+func (m *Message) Code(s string) *Message {
+	return m.write(s, "<code>"+html.EscapeString(s)+"</code>")
+}
+
+// Link adds a link to url labelled text. The plain body shows the URL after
+// the label, or alone when there is no label.
+func (m *Message) Link(url, text string) *Message {
+	a := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), escape(cmp.Or(text, url)))
+	if text == "" || text == url {
+		return m.write(url, a)
+	}
+	return m.write(text+" ("+url+")", a)
+}
+
+// Pill adds a link to the user showing name, or the MXID when name is empty.
+// It does not notify the user.
+func (m *Message) Pill(user id.UserID, name string) *Message {
+	name = cmp.Or(name, user.String())
+	return m.write(name, fmt.Sprintf(`<a href="https://matrix.to/#/%s">%s</a>`, html.EscapeString(user.String()), html.EscapeString(name)))
+}
+
+// Mention adds a pill for the user and notifies them.
+func (m *Message) Mention(user id.UserID, name string) *Message {
+	if !slices.Contains(m.mentions, user) {
+		m.mentions = append(m.mentions, user)
+	}
+	return m.Pill(user, name)
+}
+
+// MentionRoom adds @room, notifying everyone in the room.
+func (m *Message) MentionRoom() *Message {
+	m.room = true
+	return m.write("@room", "@room")
+}
+
+// Line starts a new line.
+func (m *Message) Line() *Message {
+	if m.afterBlock {
+		m.afterBlock = false
+		m.plain.WriteByte('\n')
+		return m
+	}
+	return m.write("\n", "<br>")
+}
+
+// Append adds another message, including who it notifies.
+func (m *Message) Append(other *Message) *Message {
+	m.adopt(other)
+	if other.plain.Len() == 0 && other.html.Len() == 0 {
+		return m
+	}
+	if other.startsBlock {
+		m.startBlock()
+	}
+	m.write(other.plain.String(), other.html.String())
+	m.afterBlock = other.afterBlock
+	return m
+}
+
+// List adds a bulleted list on lines of its own.
+func (m *Message) List(items ...*Message) *Message {
+	return m.list("ul", func(int) string { return "• " }, items)
+}
+
+// OrderedList adds a numbered list on lines of its own.
+func (m *Message) OrderedList(items ...*Message) *Message {
+	return m.list("ol", func(i int) string { return fmt.Sprintf("%d. ", i+1) }, items)
+}
+
+func (m *Message) list(tag string, marker func(int) string, items []*Message) *Message {
+	if len(items) == 0 {
+		return m
+	}
+	m.startBlock()
+	m.html.WriteString("<" + tag + ">")
+	for i, item := range items {
+		if i > 0 {
+			m.plain.WriteByte('\n')
+		}
+		mark := marker(i)
+		body := strings.ReplaceAll(item.plain.String(), "\n", "\n"+strings.Repeat(" ", utf8.RuneCountInString(mark)))
+		m.plain.WriteString(mark + body)
+		m.html.WriteString("<li>" + item.html.String() + "</li>")
+		m.adopt(item)
+	}
+	m.html.WriteString("</" + tag + ">")
+	m.afterBlock = true
+	return m
+}
+
+// Table adds a table on lines of its own. The plain body lines its columns
+// up with spaces. header may be nil.
+func (m *Message) Table(header []string, rows ...[]*Message) *Message {
+	if len(header) == 0 && len(rows) == 0 {
+		return m
+	}
+	cells := make([][]string, 0, len(rows)+1)
+	if len(header) > 0 {
+		cells = append(cells, header)
+	}
+	for _, row := range rows {
+		line := make([]string, len(row))
+		for i, c := range row {
+			line[i] = strings.ReplaceAll(c.plain.String(), "\n", " ")
+		}
+		cells = append(cells, line)
+	}
+	var widths []int
+	for _, line := range cells {
+		for i, c := range line {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(c))
+		}
+	}
+
+	m.startBlock()
+	for i, line := range cells {
+		if i > 0 {
+			m.plain.WriteByte('\n')
+		}
+		var b strings.Builder
+		for j, c := range line {
+			if j > 0 {
+				b.WriteString("  ")
+			}
+			b.WriteString(c + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(c)))
+		}
+		m.plain.WriteString(strings.TrimRight(b.String(), " "))
+	}
+
+	m.html.WriteString("<table>")
+	if len(header) > 0 {
+		m.html.WriteString("<thead><tr>")
+		for _, h := range header {
+			m.html.WriteString("<th>" + escape(h) + "</th>")
+		}
+		m.html.WriteString("</tr></thead>")
+	}
+	m.html.WriteString("<tbody>")
+	for _, row := range rows {
+		m.html.WriteString("<tr>")
+		for _, c := range row {
+			m.html.WriteString("<td>" + c.html.String() + "</td>")
+			m.adopt(c)
+		}
+		m.html.WriteString("</tr>")
+	}
+	m.html.WriteString("</tbody></table>")
+	m.afterBlock = true
+	return m
+}
+
+// startBlock puts a list or table on a new line in the plain body.
+func (m *Message) startBlock() {
+	m.afterBlock = false
+	if m.plain.Len() == 0 && m.html.Len() == 0 {
+		m.startsBlock = true
+	}
+	if m.plain.Len() > 0 && !strings.HasSuffix(m.plain.String(), "\n") {
+		m.plain.WriteByte('\n')
+	}
+}
+
+// adopt takes over who part notifies.
+func (m *Message) adopt(part *Message) {
+	for _, u := range part.mentions {
+		if !slices.Contains(m.mentions, u) {
+			m.mentions = append(m.mentions, u)
+		}
+	}
+	m.room = m.room || part.room
+}
+
+func (m *Message) Plain() string { return m.plain.String() }
+func (m *Message) HTML() string  { return m.html.String() }
+
+// Mentions is who the message notifies. It is never nil, so that clients
+// notify nobody else, whatever the body says.
+func (m *Message) Mentions() *event.Mentions {
+	return &event.Mentions{UserIDs: slices.Clone(m.mentions), Room: m.room}
+}
+
+// Content is the message as an m.text event.
+func (m *Message) Content() *event.MessageEventContent {
+	return &event.MessageEventContent{
+		MsgType:       event.MsgText,
+		Body:          m.Plain(),
+		Format:        event.FormatHTML,
+		FormattedBody: m.HTML(),
+		Mentions:      m.Mentions(),
+	}
+}
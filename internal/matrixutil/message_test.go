@@ -0,0 +1,246 @@
+package matrixutil
+
+import (
+	"slices"
+	"testing"
+
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	alice = id.UserID("@alice:example.org")
+	bob   = id.UserID("@bob:example.org")
+)
+
+func TestMessageEscaping(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         *Message
+		plain, html string
+	}{
+		{
+			name:  "text",
+			msg:   NewMessage().Text(`a <b> & "c" 'd'`),
+			plain: `a <b> & "c" 'd'`,
+			html:  "a &lt;b&gt; &amp; &#34;c&#34; &#39;d&#39;",
+		},
+		{
+			name:  "text keeps line breaks",
+			msg:   NewMessage().Text("x\ny"),
+			plain: "x\ny",
+			html:  "x<br>y",
+		},
+		{
+			name:  "code",
+			msg:   NewMessage().Code("a<b && c"),
+			plain: "a<b && c",
+			html:  "<code>a&lt;b &amp;&amp; c</code>",
+		},
+		{
+			name:  "link",
+			msg:   NewMessage().Link(`https://example.org/?a=1&b="2"`, "<Docs>"),
+			plain: `<Docs> (https://example.org/?a=1&b="2")`,
+			html:  `<a href="https://example.org/?a=1&amp;b=&#34;2&#34;">&lt;Docs&gt;</a>`,
+		},
+		{
+			name:  "link without label",
+			msg:   NewMessage().Link("https://example.org/?a&b", ""),
+			plain: "https://example.org/?a&b",
+			html:  `<a href="https://example.org/?a&amp;b">https://example.org/?a&amp;b</a>`,
+		},
+		{
+			name:  "pill",
+			msg:   NewMessage().Pill(alice, `<Alice & "Co">`),
+			plain: `<Alice & "Co">`,
+			html:  `<a href="https://matrix.to/#/@alice:example.org">&lt;Alice &amp; &#34;Co&#34;&gt;</a>`,
+		},
+		{
+			name:  "pill without name",
+			msg:   NewMessage().Pill(alice, ""),
+			plain: "@alice:example.org",
+			html:  `<a href="https://matrix.to/#/@alice:example.org">@alice:example.org</a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.Plain(); got != tt.plain {
+				t.Errorf("Plain() = %q, want %q", got, tt.plain)
+			}
+			if got := tt.msg.HTML(); got != tt.html {
+				t.Errorf("HTML() = %q, want %q", got, tt.html)
+			}
+		})
+	}
+}
+
+func TestMessageMentions(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   *Message
+		users []id.UserID
+		room  bool
+	}{
+		{
+			name: "pill does not notify",
+			msg:  NewMessage().Pill(alice, "Alice"),
+		},
+		{
+			name:  "mention once",
+			msg:   NewMessage().Mention(alice, "Alice").Text(" and ").Mention(alice, "Alice"),
+			users: []id.UserID{alice},
+		},
+		{
+			name:  "from list items",
+			msg:   NewMessage().List(NewMessage().Mention(alice, ""), NewMessage().Text("x"), NewMessage().Mention(bob, "")),
+			users: []id.UserID{alice, bob},
+		},
+		{
+			name:  "from table cells",
+			msg:   NewMessage().Table([]string{"who"}, []*Message{NewMessage().Mention(bob, "")}, []*Message{NewMessage().Pill(alice, "")}),
+			users: []id.UserID{bob},
+		},
+		{
+			name:  "from appended messages",
+			msg:   NewMessage().Mention(alice, "").Append(NewMessage().Mention(bob, "").Mention(alice, "")),
+			users: []id.UserID{alice, bob},
+		},
+		{
+			name: "room",
+			msg:  NewMessage().MentionRoom().Text(" lunch"),
+			room: true,
+		},
+		{
+			name: "room from a list item",
+			msg:  NewMessage().OrderedList(NewMessage().MentionRoom()),
+			room: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.msg.Mentions()
+			if m == nil {
+				t.Fatal("Mentions() = nil")
+			}
+			if !slices.Equal(m.UserIDs, tt.users) || m.Room != tt.room {
+				t.Errorf("Mentions() = %v, room %v; want %v, room %v", m.UserIDs, m.Room, tt.users, tt.room)
+			}
+			c := tt.msg.Content()
+			if !slices.Equal(c.Mentions.UserIDs, tt.users) || c.Mentions.Room != tt.room {
+				t.Errorf("Content().Mentions = %+v", c.Mentions)
+			}
+		})
+	}
+	if got := NewMessage().MentionRoom().Plain(); got != "@room" {
+		t.Errorf("MentionRoom() plain = %q", got)
+	}
+}
+
+func TestMessageLayout(t *testing.T) {
+	item := func(s string) *Message { return NewMessage().Text(s) }
+	tests := []struct {
+		name        string
+		msg         *Message
+		plain, html string
+	}{
+		{
+			name:  "line",
+			msg:   NewMessage().Text("a").Line().Text("b"),
+			plain: "a\nb",
+			html:  "a<br>b",
+		},
+		{
+			name:  "list starts a line",
+			msg:   NewMessage().Text("Title").List(item("a"), item("b")),
+			plain: "Title\n• a\n• b",
+			html:  "Title<ul><li>a</li><li>b</li></ul>",
+		},
+		{
+			name:  "list after a line break",
+			msg:   NewMessage().Text("Title").Line().List(item("a")),
+			plain: "Title\n• a",
+			html:  "Title<br><ul><li>a</li></ul>",
+		},
+		{
+			name:  "text after a block",
+			msg:   NewMessage().List(item("a")).Text("after"),
+			plain: "• a\nafter",
+			html:  "<ul><li>a</li></ul>after",
+		},
+		{
+			name:  "line after a block",
+			msg:   NewMessage().List(item("a")).Line().Text("after"),
+			plain: "• a\nafter",
+			html:  "<ul><li>a</li></ul>after",
+		},
+		{
+			name:  "blank line after a block",
+			msg:   NewMessage().List(item("a")).Line().Line().Text("after"),
+			plain: "• a\n\nafter",
+			html:  "<ul><li>a</li></ul><br>after",
+		},
+		{
+			name:  "two blocks",
+			msg:   NewMessage().List(item("a")).OrderedList(item("b")),
+			plain: "• a\n1. b",
+			html:  "<ul><li>a</li></ul><ol><li>b</li></ol>",
+		},
+		{
+			name:  "multi-line item is indented",
+			msg:   NewMessage().OrderedList(NewMessage().Text("a").Line().Text("b")),
+			plain: "1. a\n   b",
+			html:  "<ol><li>a<br>b</li></ol>",
+		},
+		{
+			name:  "table",
+			msg:   NewMessage().Text("T").Table([]string{"name", "n"}, []*Message{item("alice"), item("1")}, []*Message{item("bo"), NewMessage().Text("2\n3")}),
+			plain: "T\nname   n\nalice  1\nbo     2 3",
+			html:  "T<table><thead><tr><th>name</th><th>n</th></tr></thead><tbody><tr><td>alice</td><td>1</td></tr><tr><td>bo</td><td>2<br>3</td></tr></tbody></table>",
+		},
+		{
+			name:  "append text",
+			msg:   NewMessage().Text("a ").Append(NewMessage().Bold("b")).Text(" c"),
+			plain: "a b c",
+			html:  "a <b>b</b> c",
+		},
+		{
+			name:  "append a message ending in a block",
+			msg:   NewMessage().Append(NewMessage().Text("x").List(item("a"))).Text("after"),
+			plain: "x\n• a\nafter",
+			html:  "x<ul><li>a</li></ul>after",
+		},
+		{
+			name:  "append a message starting with a block",
+			msg:   NewMessage().Text("x").Append(NewMessage().List(item("a"))),
+			plain: "x\n• a",
+			html:  "x<ul><li>a</li></ul>",
+		},
+		{
+			name:  "append after a block",
+			msg:   NewMessage().List(item("a")).Append(NewMessage().Text("b")),
+			plain: "• a\nb",
+			html:  "<ul><li>a</li></ul>b",
+		},
+		{
+			name:  "append nothing after a block",
+			msg:   NewMessage().List(item("a")).Append(NewMessage()).Text("b"),
+			plain: "• a\nb",
+			html:  "<ul><li>a</li></ul>b",
+		},
+		{
+			name:  "empty list",
+			msg:   NewMessage().Text("a").List().Text("b"),
+			plain: "ab",
+			html:  "ab",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.Plain(); got != tt.plain {
+				t.Errorf("Plain() = %q, want %q", got, tt.plain)
+			}
+			if got := tt.msg.HTML(); got != tt.html {
+				t.Errorf("HTML() = %q, want %q", got, tt.html)
+			}
+		})
+	}
+}
@@ -16,12 +16,16 @@ import (
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/crypto/cryptohelper"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 	"modernc.org/sqlite"
 
 	"github.com/hionay/rubyChan/command"
 	"github.com/hionay/rubyChan/command/calc"
+	"github.com/hionay/rubyChan/command/config"
+	"github.com/hionay/rubyChan/command/custom"
 	"github.com/hionay/rubyChan/command/fact"
 	"github.com/hionay/rubyChan/command/gif"
+	"github.com/hionay/rubyChan/command/grep"
 	"github.com/hionay/rubyChan/command/joke"
 	"github.com/hionay/rubyChan/command/ping"
 	"github.com/hionay/rubyChan/command/poll"
@@ -33,9 +37,13 @@ import (
 	"github.com/hionay/rubyChan/command/typerace"
 	"github.com/hionay/rubyChan/command/weather"
 	"github.com/hionay/rubyChan/history"
+	"github.com/hionay/rubyChan/internal/matrixutil"
 	"github.com/hionay/rubyChan/state"
 )
 
+// startupBackfillTimeout bounds the backfill of all joined rooms at startup.
+const startupBackfillTimeout = 10 * time.Minute
+
 func init() {
 	sql.Register("sqlite3-fk-wal", &sqlite.Driver{})
 }
@@ -73,39 +81,106 @@ func run(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("store.Namespace(typerace): %w", err)
 	}
+	reminderNS, err := store.Namespace("reminder")
+	if err != nil {
+		return fmt.Errorf("store.Namespace(reminder): %w", err)
+	}
+	pollNS, err := store.Namespace("poll")
+	if err != nil {
+		return fmt.Errorf("store.Namespace(poll): %w", err)
+	}
+	quoteNS, err := store.Namespace("quote")
+	if err != nil {
+		return fmt.Errorf("store.Namespace(quote): %w", err)
+	}
+	configNS, err := store.Namespace("config")
+	if err != nil {
+		return fmt.Errorf("store.Namespace(config): %w", err)
+	}
+	customNS, err := store.Namespace("custom")
+	if err != nil {
+		return fmt.Errorf("store.Namespace(custom): %w", err)
+	}
 
 	cfg, err := NewConfig()
 	if err != nil {
 		return fmt.Errorf("NewConfig(): %w", err)
 	}
 
+	matrixutil.SetBotAdmins(cfg.BotAdmins)
+
 	cli, err := mautrix.NewClient(cfg.MatrixServer, "", "")
 	if err != nil {
 		return fmt.Errorf("mautrix.NewClient(%q): %w", cfg.MatrixServer, err)
 	}
 
-	historyStore := history.NewHistoryStore(100)
+	historyPath := "history.db"
+	if v := os.Getenv("HISTORY_DB_PATH"); v != "" {
+		historyPath = v
+	}
+	historyDB, err := sql.Open("sqlite3-fk-wal", "file:"+historyPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return fmt.Errorf("sql.Open(%q): %w", historyPath, err)
+	}
+	historyStore, err := history.NewSQLiteStore(ctx, historyDB, cfg.History)
+	if err != nil {
+		historyDB.Close()
+		return fmt.Errorf("history.NewSQLiteStore(): %w", err)
+	}
+	defer historyStore.Close()
+
+	var quoteSink quote.Sink
+	switch cfg.QuoteBackend {
+	case "api":
+		quoteSink = &quote.APISink{BaseURL: cfg.QuoteAPIURL, Token: cfg.QuoteAPIToken}
+	case "local":
+		quoteSink = quote.NewLocalStore(quoteNS)
+	default:
+		quoteSink = &quote.SiteSink{BaseURL: cfg.QuoteSiteURL}
+	}
+	qc := quote.NewQuoteCmd(historyStore, quoteSink)
 	tr := typerace.NewTypeRaceCmd(typeraceNS)
+	rm := reminder.NewRemindMeCmd(reminderNS)
+	pc := poll.NewPollCmd(pollNS)
+	cc := config.NewConfigCmd(configNS)
+	cu := custom.NewCustomCmd(customNS)
+	if cfg.ReminderSnooze > 0 {
+		rm.Snooze = cfg.ReminderSnooze
+	}
 	command.Register(
 		&calc.CalcCmd{},
+		cc,
+		cu,
 		&command.HelpCmd{},
+		&grep.GrepCmd{History: historyStore},
 		&joke.JokeCmd{},
-		&quote.QuoteCmd{History: historyStore},
-		&reminder.RemindMeCmd{},
+		qc,
+		rm,
 		&roulette.RouletteCmd{Store: rouletteNS},
 		&search.SearchCmd{GoogleAPIKey: cfg.GoogleAPIKey, GoogleCX: cfg.GoogleCX},
 		&weather.WeatherCmd{Store: weatherNS},
 		&repo.RepoCmd{},
 		&fact.FactCmd{},
-		&poll.PollCmd{},
+		pc,
 		&gif.GifCmd{APIKey: cfg.TenorAPIKey},
 		&ping.PingCmd{},
 		tr,
 	)
+	command.RegisterResolver(cu)
 	command.RegisterMessageHandler(tr)
+	command.RegisterReactionHandler(rm, pc, qc)
+	command.RegisterRedactionHandler(pc)
+	command.RegisterPollResponseHandler(pc)
+
+	limiter := command.NewLimiter(command.Limits{User: cfg.RateUser, Room: cfg.RateRoom}, cfg.APIBudget)
+	pool := command.NewPool(cfg.Workers)
+	responses := command.NewResponses()
 
 	syncer := cli.Syncer.(*mautrix.DefaultSyncer)
-	syncer.OnEventType(event.EventMessage, parseMessage(cli, historyStore))
+	syncer.OnEventType(event.EventMessage, parseMessage(cli, historyStore, cc, limiter, pool, responses, cfg.CommandTimeout))
+	syncer.OnEventType(event.EventReaction, parseReaction(cli, pool))
+	syncer.OnEventType(event.EventUnstablePollResponse, parsePollResponse(cli, pool))
+	syncer.OnEventType(event.EventRedaction, parseRedaction(cli, historyStore, responses, pool))
 	syncer.OnEventType(event.StateMember, func(ctx context.Context, evt *event.Event) {
 		if evt.GetStateKey() == cli.UserID.String() && evt.Content.AsMember().Membership == event.MembershipInvite {
 			_, err := cli.JoinRoomByID(ctx, evt.RoomID)
@@ -122,6 +197,7 @@ func run(ctx context.Context) error {
 				return
 			}
 			log.Printf("Joined room %s: %s", evt.RoomID, content.Name)
+			go backfill(ctx, cli, historyStore, cfg.History, evt.RoomID)
 		}
 	})
 
@@ -145,6 +221,25 @@ func run(ctx context.Context) error {
 	cli.Crypto = cryptoHelper
 	log.Printf("Logged in as %s", cli.UserID)
 
+	if err := rm.Restore(ctx, cli); err != nil {
+		return fmt.Errorf("rm.Restore(): %w", err)
+	}
+	if err := pc.Restore(ctx, cli); err != nil {
+		return fmt.Errorf("pc.Restore(): %w", err)
+	}
+
+	// Note what each room's history holds before syncing, so live events
+	// don't look like the end of the already-stored history, and backfill
+	// alongside the sync.
+	rooms, err := cli.JoinedRooms(ctx)
+	if err != nil {
+		return fmt.Errorf("cli.JoinedRooms(): %w", err)
+	}
+	backfills := make([]*history.Backfiller, len(rooms.JoinedRooms))
+	for i, roomID := range rooms.JoinedRooms {
+		backfills[i] = history.NewBackfiller(historyStore, roomID, cfg.History.Limit(roomID))
+	}
+
 	srv := newWebhookServer(cli, cfg.WebhookAddr)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
@@ -157,6 +252,16 @@ func run(ctx context.Context) error {
 	}()
 
 	var wg sync.WaitGroup
+	wg.Go(func() {
+		bctx, cancel := context.WithTimeout(ctx, startupBackfillTimeout)
+		defer cancel()
+		for _, b := range backfills {
+			runBackfill(bctx, cli, b)
+		}
+		if errors.Is(bctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Startup backfill stopped after %s", startupBackfillTimeout)
+		}
+	})
 	wg.Go(func() {
 		if err := cli.SyncWithContext(ctx); err != nil {
 			if errors.Is(err, context.Canceled) {
@@ -174,5 +279,21 @@ func run(ctx context.Context) error {
 		log.Printf("Server shutdown error: %v", err)
 	}
 	wg.Wait()
+	pool.Wait()
 	return nil
 }
+
+func backfill(ctx context.Context, cli *mautrix.Client, store history.Store, retention history.Retention, roomID id.RoomID) {
+	runBackfill(ctx, cli, history.NewBackfiller(store, roomID, retention.Limit(roomID)))
+}
+
+func runBackfill(ctx context.Context, cli *mautrix.Client, b *history.Backfiller) {
+	n, err := b.Run(ctx, cli)
+	if err != nil {
+		log.Printf("Backfill error for %s: %v", b.RoomID(), err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Backfilled %d messages in %s", n, b.RoomID())
+	}
+}
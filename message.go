@@ -2,29 +2,30 @@ package main
 
 import (
 	"context"
-	"slices"
+	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 
 	"github.com/hionay/rubyChan/command"
+	"github.com/hionay/rubyChan/command/config"
 	"github.com/hionay/rubyChan/history"
 )
 
-const cmdPrefix = "!"
-
-func parseMessage(cli *mautrix.Client, store *history.HistoryStore) func(context.Context, *event.Event) {
+// parseMessage records every message and hands commands and message handlers
+// to the pool, so a slow command holds up only its own room. The other
+// handlers below go through the same pool to stay ordered with commands.
+//
+// Edits of a recent command run it again, with responses turning its new
+// replies into edits of the old ones.
+func parseMessage(cli *mautrix.Client, store history.Store, rooms *config.ConfigCmd, limiter *command.Limiter, pool *command.Pool, responses *command.Responses, timeout time.Duration) func(context.Context, *event.Event) {
 	st := time.Now()
 	return func(ctx context.Context, evt *event.Event) {
-		raw := strings.TrimSpace(evt.Content.AsMessage().Body)
-		nick := evt.Sender.Localpart()
-		store.Add(evt.RoomID, history.HistoryMessage{
-			Sender:    nick,
-			Body:      raw,
-			Timestamp: evt.Timestamp,
-		})
+		msg, replaces := history.Record(store, evt)
 
 		// Ignore commands from the history
 		ts := time.UnixMilli(evt.Timestamp)
@@ -32,24 +33,138 @@ func parseMessage(cli *mautrix.Client, store *history.HistoryStore) func(context
 			return
 		}
 
-		body, ok := strings.CutPrefix(raw, cmdPrefix)
-		if !ok {
-			for _, h := range command.MessageHandlers() {
-				h.HandleMessage(ctx, cli, evt)
+		settings := rooms.Settings(evt.RoomID)
+		ctx = command.WithRoomSettings(ctx, settings)
+		body, isCmd := strings.CutPrefix(msg.Body, settings.CommandPrefix())
+		if !isCmd && replaces == "" {
+			submit(pool, evt, func() {
+				for _, h := range command.MessageHandlers() {
+					h.HandleMessage(ctx, cli, evt)
+				}
+			})
+			return
+		}
+
+		cmdEvt := evt
+		if replaces != "" {
+			cmdEvt = editedCommand(evt, replaces)
+		}
+		var cmd command.Command
+		var name string
+		var args []string
+		if fields := strings.Fields(body); isCmd && len(fields) > 0 {
+			name, args = fields[0], fields[1:]
+			cmd = command.LookupIn(evt.RoomID, name)
+			if cmd != nil && !settings.Enabled(cmd) {
+				cmd = nil
 			}
+		}
+		if cmd != nil && replaces != "" && command.IsStateful(cmd) {
 			return
 		}
-		fields := strings.Fields(body)
-		if len(fields) == 0 {
+		ctx, ok := responses.Begin(ctx, evt, cmdEvt.ID)
+		if !ok {
 			return
 		}
 
-		name, args := fields[0], fields[1:]
-		for _, cmd := range command.Registry {
-			if name == cmd.Name() || slices.Contains(cmd.Aliases(), name) {
-				cmd.Execute(ctx, cli, evt, args)
+		argText := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body), name))
+		ctx = command.WithInvocation(ctx, command.Invocation{Name: name, ArgText: argText})
+		submit(pool, evt, func() {
+			defer responses.End(ctx, cli)
+			if cmd == nil {
+				if s := command.Suggestions(ctx, evt.RoomID, name); len(s) > 0 && limiter.AllowSuggestion(evt.RoomID, evt.Sender) {
+					command.Reply(ctx, cli, cmdEvt, fmt.Sprintf("Unknown command %s%s. Did you mean %s?", settings.CommandPrefix(), name, strings.Join(s, " or ")))
+				}
+				return
+			}
+			command.MarkStateful(ctx, cmd)
+			if err := command.Check(ctx, cli, cmdEvt, cmd, args); err != nil {
+				command.Reply(ctx, cli, cmdEvt, err.Error())
+				return
+			}
+			if wait, notify := limiter.Allow(cmd, evt.RoomID, evt.Sender); wait > 0 {
+				if notify {
+					command.Reply(ctx, cli, cmdEvt, command.SlowDown(wait))
+				}
 				return
 			}
+			command.Run(ctx, cli, cmdEvt, cmd, args, timeout)
+		})
+	}
+}
+
+// editedCommand is the command event cmdID as it reads after the edit evt.
+func editedCommand(evt *event.Event, cmdID id.EventID) *event.Event {
+	content := evt.Content.AsMessage()
+	if content.NewContent != nil {
+		content = content.NewContent
+	}
+	cmdEvt := *evt
+	cmdEvt.ID = cmdID
+	cmdEvt.Content = event.Content{Parsed: content}
+	return &cmdEvt
+}
+
+func submit(pool *command.Pool, evt *event.Event, job func()) {
+	if !pool.Submit(evt.RoomID, job) {
+		log.Printf("Dropped %s in %s: too many pending jobs", evt.ID, evt.RoomID)
+	}
+}
+
+// parseReaction hands reactions from before startup only to the handlers
+// that want them.
+func parseReaction(cli *mautrix.Client, pool *command.Pool) func(context.Context, *event.Event) {
+	st := time.Now()
+	return func(ctx context.Context, evt *event.Event) {
+		if evt.Sender == cli.UserID {
+			return
+		}
+		backlog := time.UnixMilli(evt.Timestamp).Before(st)
+		submit(pool, evt, func() {
+			for _, h := range command.ReactionHandlers() {
+				if !backlog {
+					h.HandleReaction(ctx, cli, evt)
+				} else if bh, ok := h.(command.BacklogReactionHandler); ok {
+					bh.HandleBacklogReaction(ctx, cli, evt)
+				}
+			}
+		})
+	}
+}
+
+// parsePollResponse does not skip events from before startup: votes cast
+// while the bot was down still count, and recording them again is harmless.
+func parsePollResponse(cli *mautrix.Client, pool *command.Pool) func(context.Context, *event.Event) {
+	return func(ctx context.Context, evt *event.Event) {
+		if evt.Sender == cli.UserID {
+			return
+		}
+		submit(pool, evt, func() {
+			for _, h := range command.PollResponseHandlers() {
+				h.HandlePollResponse(ctx, cli, evt)
+			}
+		})
+	}
+}
+
+func parseRedaction(cli *mautrix.Client, store history.Store, responses *command.Responses, pool *command.Pool) func(context.Context, *event.Event) {
+	st := time.Now()
+	return func(ctx context.Context, evt *event.Event) {
+		redacts := evt.Redacts
+		if redacts == "" {
+			redacts = evt.Content.AsRedaction().Redacts
 		}
+		store.Redact(evt.RoomID, redacts)
+
+		ts := time.UnixMilli(evt.Timestamp)
+		if ts.Before(st) {
+			return
+		}
+		submit(pool, evt, func() {
+			responses.Redact(ctx, cli, evt.RoomID, redacts)
+			for _, h := range command.RedactionHandlers() {
+				h.HandleRedaction(ctx, cli, evt)
+			}
+		})
 	}
 }
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -101,3 +102,38 @@ func (n *Namespace) PutJSON(key string, src any) error {
 	}
 	return n.Put(key, data)
 }
+
+// ForEach calls fn for every key in the namespace that starts with prefix, in
+// key order. The value slice is only valid for the duration of the call.
+func (n *Namespace) ForEach(prefix string, fn func(key string, value []byte) error) error {
+	return n.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(n.bucket)
+		if b == nil {
+			return fmt.Errorf("bucket %q missing", n.bucket)
+		}
+		p := []byte(prefix)
+		c := b.Cursor()
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := fn(string(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NextSequence returns a monotonically increasing integer for the namespace
+// that survives restarts.
+func (n *Namespace) NextSequence() (uint64, error) {
+	var seq uint64
+	err := n.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(n.bucket)
+		if b == nil {
+			return fmt.Errorf("bucket %q missing", n.bucket)
+		}
+		var e error
+		seq, e = b.NextSequence()
+		return e
+	})
+	return seq, err
+}